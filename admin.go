@@ -0,0 +1,199 @@
+// admin.go serves an optional admin page for operators, listing the
+// groups and their caches, the pool's peers and their recent errors,
+// and which peer owns a given key.
+
+package groupcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// peerErrorHistory is how many recent errors of each peer a group
+// remembers.
+const peerErrorHistory = 10
+
+// A PeerError is an error returned by a peer when loading a key from
+// it.
+type PeerError struct {
+	Time  time.Time `json:"time"`
+	Group string    `json:"group"`
+	Key   string    `json:"key"`
+	Err   string    `json:"error"`
+}
+
+// recordPeerError adds err, returned by peer for key, to the group's
+// history of peer errors.
+func (g *Group) recordPeerError(peer ProtoGetter, key string, err error) {
+	name := peerName(peer)
+	g.peerErrsMu.Lock()
+	defer g.peerErrsMu.Unlock()
+	if g.peerErrs == nil {
+		g.peerErrs = make(map[string][]PeerError)
+	}
+	errs := append(g.peerErrs[name], PeerError{Time: timeNow(), Group: g.name, Key: key, Err: err.Error()})
+	if len(errs) > peerErrorHistory {
+		errs = append(errs[:0], errs[len(errs)-peerErrorHistory:]...)
+	}
+	g.peerErrs[name] = errs
+}
+
+// forgetPeerErrors drops the error history of peers no longer among
+// live, such as those removed by a pool's Set.
+func (g *Group) forgetPeerErrors(live []ProtoGetter) {
+	names := make(map[string]bool, len(live))
+	for _, peer := range live {
+		names[peerName(peer)] = true
+	}
+	g.peerErrsMu.Lock()
+	defer g.peerErrsMu.Unlock()
+	for name := range g.peerErrs {
+		if !names[name] {
+			delete(g.peerErrs, name)
+		}
+	}
+}
+
+// RecentPeerErrors returns the last few errors the group's peers
+// returned, oldest first, keyed by peer.
+func (g *Group) RecentPeerErrors() map[string][]PeerError {
+	g.peerErrsMu.Lock()
+	defer g.peerErrsMu.Unlock()
+	errs := make(map[string][]PeerError, len(g.peerErrs))
+	for peer, e := range g.peerErrs {
+		errs[peer] = append([]PeerError(nil), e...)
+	}
+	return errs
+}
+
+// peerName returns the name of peer: the base URL or address it was
+// passed to Set with, for the peers of an HTTPPool or GRPCPool.
+func peerName(peer ProtoGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", peer)
+}
+
+func (h *httpGetter) String() string {
+	if h.peer != "" {
+		return h.peer
+	}
+	return h.baseURL
+}
+
+func (h *grpcGetter) String() string { return h.addr }
+
+type adminPage struct {
+	Self      string           `json:"self"`
+	Placement int              `json:"placement_version"`
+	Stats     map[string]int64 `json:"stats"`
+	Peers     []adminPeer      `json:"peers"`
+	Groups    []adminGroup     `json:"groups"`
+}
+
+type adminPeer struct {
+	Peer    string        `json:"peer"`
+	Healthy bool          `json:"healthy"`
+	Breaker *BreakerState `json:"breaker,omitempty"`
+	Errors  []PeerError   `json:"errors,omitempty"` // newest first
+}
+
+type adminGroup struct {
+	Name       string           `json:"name"`
+	CacheBytes int64            `json:"cache_bytes"`
+	Stats      map[string]int64 `json:"stats"`
+	MainCache  CacheStats       `json:"main_cache"`
+	HotCache   CacheStats       `json:"hot_cache"`
+}
+
+type adminOwner struct {
+	Key   string `json:"key"`
+	Owner string `json:"owner"` // empty without peers
+	Self  bool   `json:"self"`  // whether the owner is this peer
+}
+
+// AdminHandler returns a handler serving, as JSON, the state of the
+// pool: its peers and placement version, the last errors returned by
+// each peer, and the groups the pool serves with their Stats and
+// CacheStats. Given a "key" parameter, it instead reports which peer
+// owns that key.
+//
+// The handler is not registered by the pool. It may be, for instance
+// at "/groupcachez", on a mux reachable by operators only: unlike the
+// pool's own handler, it does not check Auth.
+func (p *HTTPPool) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, "GET", "HEAD") {
+			return
+		}
+		var v interface{}
+		if key, ok := r.URL.Query()["key"]; ok {
+			v = p.owner(key[0])
+		} else {
+			v = p.adminPage()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	})
+}
+
+func (p *HTTPPool) owner(key string) adminOwner {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o := adminOwner{Key: key}
+	if !p.peers.IsEmpty() {
+		o.Owner = p.peers.Hash(key)[0]
+		o.Self = o.Owner == p.self
+	}
+	return o
+}
+
+func (p *HTTPPool) adminPage() adminPage {
+	page := adminPage{Self: p.self, Stats: statsMap(&p.Stats)}
+	breakers := p.Breakers()
+	p.mu.Lock()
+	page.Placement = p.placement
+	for _, peer := range p.members {
+		ap := adminPeer{Peer: peer, Healthy: p.health[peer] == nil || !p.health[peer].down}
+		if b, ok := breakers[peer]; ok {
+			ap.Breaker = &b
+		}
+		page.Peers = append(page.Peers, ap)
+	}
+	p.mu.Unlock()
+
+	for _, g := range p.servedGroups() {
+		page.Groups = append(page.Groups, adminGroup{
+			Name:       g.Name(),
+			CacheBytes: g.CacheBytes(),
+			Stats:      statsMap(&g.Stats),
+			MainCache:  g.CacheStats(MainCache),
+			HotCache:   g.CacheStats(HotCache),
+		})
+		errs := g.RecentPeerErrors()
+		for i := range page.Peers {
+			page.Peers[i].Errors = append(page.Peers[i].Errors, errs[page.Peers[i].Peer]...)
+		}
+	}
+	for _, ap := range page.Peers {
+		sort.Slice(ap.Errors, func(i, j int) bool { return ap.Errors[i].Time.After(ap.Errors[j].Time) })
+	}
+	return page
+}
+
+// servedGroups returns the groups the pool serves, sorted by name.
+func (p *HTTPPool) servedGroups() []*Group {
+	var served []*Group
+	for _, g := range sortedGroups() {
+		if servedGroup(g.name, p) != nil {
+			served = append(served, g)
+		}
+	}
+	return served
+}
@@ -0,0 +1,117 @@
+package groupcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == defaultBasePath+helloPath {
+			http.NotFound(w, r)
+			return
+		}
+		httpError(w, http.StatusInternalServerError, "internal", "disk on fire")
+	}))
+	defer failing.Close()
+
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	g := NewGroupOpts("TestAdminHandler-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+	p.Set("http://self", failing.URL)
+
+	var remote string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprint("key", i)
+		if _, ok := p.PickPeer(key); ok {
+			remote = key
+		}
+		var s string
+		if err := g.Get(nil, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if remote == "" {
+		t.Fatal("no key owned by the failing peer")
+	}
+
+	get := func(query string, v interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		p.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/groupcachez"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", query, rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+	}
+
+	var page adminPage
+	get("", &page)
+	if page.Self != "http://self" || page.Placement == 0 || len(page.Peers) != 2 {
+		t.Errorf("page = self %q, placement %d, %d peers; want http://self, a version and 2 peers", page.Self, page.Placement, len(page.Peers))
+	}
+	var found bool
+	for _, ag := range page.Groups {
+		if ag.Name != g.Name() {
+			continue
+		}
+		found = true
+		if ag.Stats["Gets"] != 20 || ag.MainCache.Items == 0 {
+			t.Errorf("group stats: %d gets, %d items in mainCache; want 20 and some", ag.Stats["Gets"], ag.MainCache.Items)
+		}
+	}
+	if !found {
+		t.Errorf("page lists groups %v, without %s", page.Groups, g.Name())
+	}
+	for _, ap := range page.Peers {
+		if ap.Peer != failing.URL {
+			continue
+		}
+		if len(ap.Errors) == 0 || ap.Errors[0].Group != g.Name() {
+			t.Errorf("failing peer's errors = %v; want errors of %s", ap.Errors, g.Name())
+		}
+	}
+
+	var owner adminOwner
+	get("?key="+remote, &owner)
+	if owner.Owner != failing.URL || owner.Self {
+		t.Errorf("owner of %q = %+v; want %s", remote, owner, failing.URL)
+	}
+}
+
+func TestRecentPeerErrors(t *testing.T) {
+	g := &Group{name: "TestRecentPeerErrors"}
+	peer := &httpGetter{peer: "http://peer"}
+	for i := 0; i < peerErrorHistory+5; i++ {
+		g.recordPeerError(peer, fmt.Sprint(i), errors.New("boom"))
+	}
+	errs := g.RecentPeerErrors()["http://peer"]
+	if len(errs) != peerErrorHistory || errs[0].Key != "5" {
+		t.Errorf("kept %d errors, the oldest for key %q; want %d, from key %q", len(errs), errs[0].Key, peerErrorHistory, "5")
+	}
+}
+
+func TestRecentPeerErrorsOfRemovedPeers(t *testing.T) {
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	g := NewGroupOpts("TestRecentPeerErrorsOfRemovedPeers-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+
+	p.Set("http://self", "http://a", "http://b")
+	g.recordPeerError(p.httpGetters["http://a"], "k", errors.New("boom"))
+	g.recordPeerError(p.httpGetters["http://b"], "k", errors.New("boom"))
+	p.Set("http://self", "http://b")
+	errs := g.RecentPeerErrors()
+	if len(errs) != 1 || len(errs["http://b"]) != 1 {
+		t.Errorf("errors after removing a = %v; want only those of b", errs)
+	}
+}
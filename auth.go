@@ -0,0 +1,226 @@
+// auth.go authenticates the requests peers make to each other, and
+// authorizes them per group.
+
+package groupcache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Authenticator adds credentials to the requests an HTTPPool sends
+// its peers, and checks those of the requests it serves.
+type Authenticator interface {
+	// Sign adds credentials to r, a request to a peer with the
+	// given body.
+	Sign(r *http.Request, body []byte) error
+
+	// Verify checks the credentials of r, a request from a peer
+	// with the given body, and returns the identity they prove.
+	Verify(r *http.Request, body []byte) (identity string, err error)
+}
+
+// A headerVerifier is an Authenticator that can check the credentials
+// of a request from its headers alone, so that a request without them
+// is turned away before its body is read. Verify is still called once
+// the body has been read.
+type headerVerifier interface {
+	verifyHeader(r *http.Request) (identity string, err error)
+}
+
+// errUnauthenticated is returned by Verify for a request without
+// valid credentials.
+var errUnauthenticated = errors.New("groupcache: request not authenticated")
+
+const (
+	hmacScheme       = "GroupcacheHMAC"
+	hmacDateHeader   = "X-Groupcache-Date"
+	hmacBodyHeader   = "X-Groupcache-Content-Sha256"
+	defaultHMACSkew  = 5 * time.Minute
+	defaultHMACIdent = "cluster"
+)
+
+// HMACAuth authenticates requests by signing them with a key shared by
+// the whole cluster. The signature covers the method, path, time of the
+// request and the SHA-256 of its body, sent in a header so that the
+// signature is checked before the body is read. A signed request is
+// accepted for MaxSkew either side of its time.
+//
+// Requests carry no nonce, so a captured request, a write included,
+// can be replayed as often as wanted within that window: up to five
+// minutes by default. Send peer traffic over TLS, which keeps requests
+// from being captured, and keep MaxSkew as short as the peers' clocks
+// allow.
+type HMACAuth struct {
+	// Key is the shared key.
+	Key []byte
+
+	// Identity is the identity of peers signing with Key, as
+	// passed to HTTPPoolOptions.Authorize. If empty, it is
+	// "cluster".
+	Identity string
+
+	// MaxSkew specifies how far the time of a request may be from
+	// the time it is served, which is also how long a captured
+	// request can be replayed. If zero, it defaults to five minutes.
+	MaxSkew time.Duration
+}
+
+func (a *HMACAuth) Sign(r *http.Request, body []byte) error {
+	date := strconv.FormatInt(timeNow().Unix(), 10)
+	sum := bodySum(body)
+	r.Header.Set(hmacDateHeader, date)
+	r.Header.Set(hmacBodyHeader, sum)
+	r.Header.Set("Authorization", hmacScheme+" "+a.sign(r, date, sum))
+	return nil
+}
+
+func (a *HMACAuth) Verify(r *http.Request, body []byte) (string, error) {
+	identity, err := a.verifyHeader(r)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(r.Header.Get(hmacBodyHeader)), []byte(bodySum(body))) {
+		return "", errUnauthenticated
+	}
+	return identity, nil
+}
+
+// verifyHeader checks the signature of r against the body sum in its
+// header, which Verify then checks against the body.
+func (a *HMACAuth) verifyHeader(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, hmacScheme+" ") {
+		return "", errUnauthenticated
+	}
+	sig := strings.TrimPrefix(auth, hmacScheme+" ")
+	date := r.Header.Get(hmacDateHeader)
+	secs, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return "", errUnauthenticated
+	}
+	skew := a.MaxSkew
+	if skew <= 0 {
+		skew = defaultHMACSkew
+	}
+	if d := timeNow().Sub(time.Unix(secs, 0)); d > skew || d < -skew {
+		return "", errUnauthenticated
+	}
+	if !hmac.Equal([]byte(sig), []byte(a.sign(r, date, r.Header.Get(hmacBodyHeader)))) {
+		return "", errUnauthenticated
+	}
+	if a.Identity == "" {
+		return defaultHMACIdent, nil
+	}
+	return a.Identity, nil
+}
+
+// sign returns the signature of r, sent at date with a body whose
+// bodySum is sum.
+func (a *HMACAuth) sign(r *http.Request, date, sum string) string {
+	mac := hmac.New(sha256.New, a.Key)
+	mac.Write([]byte(r.Method + "\n" + r.URL.EscapedPath() + "\n" + date + "\n" + sum))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// bodySum returns the hex SHA-256 of body.
+func bodySum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// BearerAuth authenticates requests by bearer tokens.
+type BearerAuth struct {
+	// Token is sent with requests to peers.
+	Token string
+
+	// Tokens maps the tokens accepted from peers to the identity
+	// each proves, as passed to HTTPPoolOptions.Authorize.
+	Tokens map[string]string
+}
+
+func (a *BearerAuth) Sign(r *http.Request, body []byte) error {
+	r.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+func (a *BearerAuth) Verify(r *http.Request, body []byte) (string, error) {
+	return a.verifyHeader(r)
+}
+
+func (a *BearerAuth) verifyHeader(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", errUnauthenticated
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	identity, ok := "", false
+	// Compare against every token, so that the time taken tells
+	// nothing of which came close.
+	for t, id := range a.Tokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			identity, ok = id, true
+		}
+	}
+	if !ok {
+		return "", errUnauthenticated
+	}
+	return identity, nil
+}
+
+// sign adds the pool's credentials, if any, to req, whose body is
+// body.
+func (h *httpGetter) sign(req *http.Request, body []byte) error {
+	if h.pool == nil || h.pool.opts.Auth == nil {
+		return nil
+	}
+	return h.pool.opts.Auth.Sign(req, body)
+}
+
+// preauthenticate checks the credentials of r before its body is read,
+// if the pool's Authenticator is a headerVerifier. It writes a 401
+// response and returns false if they are missing or wrong.
+func (p *HTTPPool) preauthenticate(w http.ResponseWriter, r *http.Request) bool {
+	v, ok := p.opts.Auth.(headerVerifier)
+	if !ok {
+		return true
+	}
+	if _, err := v.verifyHeader(r); err != nil {
+		httpError(w, http.StatusUnauthorized, "unauthorized", "request not authenticated")
+		return false
+	}
+	return true
+}
+
+// authenticate checks the credentials of r, whose body is body, and
+// returns the identity of the peer that sent it. It writes a 401
+// response and returns false if r is not authenticated.
+func (p *HTTPPool) authenticate(w http.ResponseWriter, r *http.Request, body []byte) (identity string, ok bool) {
+	if p.opts.Auth == nil {
+		return "", true
+	}
+	identity, err := p.opts.Auth.Verify(r, body)
+	if err != nil {
+		httpError(w, http.StatusUnauthorized, "unauthorized", "request not authenticated")
+		return "", false
+	}
+	return identity, true
+}
+
+// authorize reports whether identity may read, or if write is set
+// write, keys of group. It writes a 403 response if not.
+func (p *HTTPPool) authorize(w http.ResponseWriter, identity, group string, write bool) bool {
+	if p.opts.Auth == nil || p.opts.Authorize == nil || p.opts.Authorize(identity, group, write) {
+		return true
+	}
+	httpError(w, http.StatusForbidden, "forbidden", identity+" may not access group "+group)
+	return false
+}
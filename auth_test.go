@@ -0,0 +1,134 @@
+package groupcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// authGet sends a Get for key in group, carrying value if non-empty,
+// to srv through a pool authenticating with auth.
+func authGet(srv *httptest.Server, auth Authenticator, group, key, value string) error {
+	client := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Auth: auth}}
+	client.Set(srv.URL)
+	in := &pb.GetRequest{Group: proto.String(group), Key: proto.String(key)}
+	if value != "" {
+		in.Value = []byte(value)
+	}
+	return client.httpGetters[srv.URL].Get(nil, in, new(pb.GetResponse))
+}
+
+func wantStatus(t *testing.T, what string, err error, status int) {
+	t.Helper()
+	switch {
+	case status == http.StatusOK && err != nil:
+		t.Errorf("%s: %v", what, err)
+	case status != http.StatusOK && (err == nil || !strings.Contains(err.Error(), http.StatusText(status))):
+		t.Errorf("%s = %v; want %d %s", what, err, status, http.StatusText(status))
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	auth := &HMACAuth{Key: []byte("cluster key")}
+	server := &HTTPPool{opts: HTTPPoolOptions{
+		BasePath: defaultBasePath,
+		Auth:     auth,
+		Authorize: func(identity, group string, write bool) bool {
+			return identity == "cluster" && !write
+		},
+	}}
+	g := NewGroupOpts("TestHMACAuth-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: server})
+	defer DeregisterGroup(g.Name())
+	server.Set()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	wantStatus(t, "signed read", authGet(srv, auth, g.Name(), "k", ""), http.StatusOK)
+	wantStatus(t, "unsigned read", authGet(srv, nil, g.Name(), "k", ""), http.StatusUnauthorized)
+	wantStatus(t, "read signed with another key", authGet(srv, &HMACAuth{Key: []byte("wrong")}, g.Name(), "k", ""), http.StatusUnauthorized)
+	wantStatus(t, "signed write", authGet(srv, auth, g.Name(), "k", "new value"), http.StatusForbidden)
+
+	// A signature is only good for so long.
+	req := httptest.NewRequest("GET", defaultBasePath+g.Name()+"/k", nil)
+	auth.Sign(req, nil)
+	now = now.Add(defaultHMACSkew + time.Second)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed request: status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Health checks need no credentials.
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", defaultBasePath+healthPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("health check: status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	server := &HTTPPool{opts: HTTPPoolOptions{
+		BasePath: defaultBasePath,
+		Auth:     &BearerAuth{Tokens: map[string]string{"r-token": "reader", "w-token": "writer"}},
+		Authorize: func(identity, group string, write bool) bool {
+			return identity == "writer" || !write
+		},
+	}}
+	g := NewGroupOpts("TestBearerAuth-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: server})
+	defer DeregisterGroup(g.Name())
+	server.Set()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	reader := &BearerAuth{Token: "r-token"}
+	writer := &BearerAuth{Token: "w-token"}
+	wantStatus(t, "reader read", authGet(srv, reader, g.Name(), "k", ""), http.StatusOK)
+	wantStatus(t, "reader write", authGet(srv, reader, g.Name(), "k", "v"), http.StatusForbidden)
+	wantStatus(t, "writer write", authGet(srv, writer, g.Name(), "k", "v"), http.StatusOK)
+	wantStatus(t, "unknown token", authGet(srv, &BearerAuth{Token: "x"}, g.Name(), "k", ""), http.StatusUnauthorized)
+}
+
+// unreadBody fails the test if it is read.
+type unreadBody struct{ t *testing.T }
+
+func (b unreadBody) Read(p []byte) (int, error) {
+	b.t.Error("body of an unauthenticated request read")
+	return 0, io.EOF
+}
+
+func TestAuthBeforeBody(t *testing.T) {
+	for _, auth := range []Authenticator{
+		&HMACAuth{Key: []byte("cluster key")},
+		&BearerAuth{Tokens: map[string]string{"token": "peer"}},
+	} {
+		server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Auth: auth}}
+		req := httptest.NewRequest("POST", defaultBasePath+"group/k", unreadBody{t})
+		req.ContentLength = 1 << 20
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%T: unsigned request: status = %d; want %d", auth, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// A signature is checked against the body it was made for.
+	auth := &HMACAuth{Key: []byte("cluster key")}
+	req := httptest.NewRequest("POST", defaultBasePath+"group/k", strings.NewReader("forged"))
+	auth.Sign(req, []byte("signed"))
+	if _, err := auth.Verify(req, []byte("forged")); err == nil {
+		t.Error("request verified with a body other than the one signed")
+	}
+}
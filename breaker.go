@@ -0,0 +1,217 @@
+// breaker.go stops sending requests to a peer that keeps failing or
+// answering slowly, so that its load falls back elsewhere while it
+// recovers.
+
+package groupcache
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// breakersPath is the path, under the pool's BasePath, of the
+// endpoint reporting the state of each peer's circuit breaker.
+const breakersPath = "_breakers"
+
+const (
+	defaultBreakerWindow  = 20
+	defaultBreakerOpenFor = 5 * time.Second
+)
+
+// errBreakerOpen is returned for requests to a peer whose circuit
+// breaker is open.
+var errBreakerOpen = errors.New("groupcache: peer's circuit breaker is open")
+
+// A BreakerState is the state of a peer's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests without sending them.
+	BreakerOpen
+	// BreakerHalfOpen lets a single request through to find out
+	// whether the peer has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// A breaker is the circuit breaker of one peer.
+type breaker struct {
+	mu       sync.Mutex
+	state    BreakerState
+	results  []bool // ring of recent outcomes, true for failures
+	next     int    // index in results of the next outcome
+	failures int    // failures in results
+	openedAt time.Time
+	probing  bool // a half-open trial request is in flight
+}
+
+// allow reports whether a request may be sent.
+func (b *breaker) allow(openFor time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if timeNow().Sub(b.openedAt) < openFor {
+			return false
+		}
+		b.state = BreakerHalfOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+	default:
+		return true
+	}
+	b.probing = true
+	return true
+}
+
+// abandon records that an allowed request was given up by its caller,
+// telling nothing about the peer.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record records the outcome of an allowed request, and reports
+// whether it opened the breaker.
+func (b *breaker) record(failed bool, window int, errorRate float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		b.reset()
+		if failed {
+			b.state = BreakerOpen
+			b.openedAt = timeNow()
+			return true
+		}
+		b.state = BreakerClosed
+		return false
+	case BreakerOpen:
+		// Sent before the breaker opened.
+		return false
+	}
+
+	if cap(b.results) != window {
+		b.results = make([]bool, 0, window)
+		b.next, b.failures = 0, 0
+	}
+	if len(b.results) < window {
+		b.results = append(b.results, failed)
+	} else {
+		if b.results[b.next] {
+			b.failures--
+		}
+		b.results[b.next] = failed
+	}
+	b.next = (b.next + 1) % window
+	if failed {
+		b.failures++
+	}
+	if len(b.results) == window && float64(b.failures) >= errorRate*float64(window) {
+		b.state = BreakerOpen
+		b.openedAt = timeNow()
+		b.reset()
+		return true
+	}
+	return false
+}
+
+// reset forgets the recent outcomes. b.mu must be held.
+func (b *breaker) reset() {
+	b.results = b.results[:0]
+	b.next, b.failures = 0, 0
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerAllow reports whether a request to h's peer may be sent.
+func (h *httpGetter) breakerAllow() bool {
+	if h.breaker == nil {
+		return true
+	}
+	openFor := h.pool.opts.BreakerOpenFor
+	if openFor <= 0 {
+		openFor = defaultBreakerOpenFor
+	}
+	if !h.breaker.allow(openFor) {
+		h.pool.Stats.BreakerRejects.Add(1)
+		return false
+	}
+	return true
+}
+
+// breakerRecord records the outcome of a request to h's peer that
+// took d. Requests slower than BreakerSlowAfter count as failures.
+func (h *httpGetter) breakerRecord(failed bool, d time.Duration) {
+	if h.breaker == nil {
+		return
+	}
+	o := &h.pool.opts
+	if o.BreakerSlowAfter > 0 && d > o.BreakerSlowAfter {
+		failed = true
+	}
+	window := o.BreakerWindow
+	if window <= 0 {
+		window = defaultBreakerWindow
+	}
+	if h.breaker.record(failed, window, o.BreakerErrorRate) {
+		h.pool.Stats.BreakerTrips.Add(1)
+	}
+}
+
+// breakerAbandon records that a request to h's peer was abandoned.
+func (h *httpGetter) breakerAbandon() {
+	if h.breaker != nil {
+		h.breaker.abandon()
+	}
+}
+
+// Breakers returns the state of each peer's circuit breaker. It is
+// empty unless BreakerErrorRate is set.
+func (p *HTTPPool) Breakers() map[string]BreakerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	states := make(map[string]BreakerState)
+	for peer, h := range p.httpGetters {
+		if h.breaker != nil {
+			states[peer] = h.breaker.current()
+		}
+	}
+	return states
+}
+
+// serveBreakers writes the state of each peer's circuit breaker as
+// a JSON object.
+func (p *HTTPPool) serveBreakers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Breakers())
+}
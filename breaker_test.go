@@ -0,0 +1,102 @@
+package groupcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var now time.Time
+	defer setTimeNow(&now)()
+
+	var requests, failing int32 = 0, 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) != 0 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := proto.Marshal(&pb.GetResponse{Value: []byte("v")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	p := &HTTPPool{opts: HTTPPoolOptions{
+		BasePath:         defaultBasePath,
+		BreakerErrorRate: 0.5,
+		BreakerWindow:    4,
+		BreakerOpenFor:   time.Minute,
+	}}
+	p.Set(srv.URL)
+	get := func() error {
+		return p.httpGetters[srv.URL].Get(nil, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("k")}, new(pb.GetResponse))
+	}
+	state := func() BreakerState { return p.Breakers()[srv.URL] }
+
+	for i := 0; i < 4; i++ {
+		if state() != BreakerClosed {
+			t.Fatalf("breaker %v after %d failures; want closed", state(), i)
+		}
+		get()
+	}
+	if state() != BreakerOpen {
+		t.Fatalf("breaker %v after 4 failures; want open", state())
+	}
+	if err := get(); err != errBreakerOpen {
+		t.Errorf("Get through open breaker = %v; want %v", err, errBreakerOpen)
+	}
+	if got := atomic.LoadInt32(&requests); got != 4 {
+		t.Errorf("peer got %d requests; want 4", got)
+	}
+
+	// A failed trial keeps the breaker open.
+	now = now.Add(time.Minute)
+	get()
+	if state() != BreakerOpen {
+		t.Fatalf("breaker %v after failed trial; want open", state())
+	}
+
+	// A successful one closes it.
+	atomic.StoreInt32(&failing, 0)
+	now = now.Add(time.Minute)
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if state() != BreakerClosed {
+		t.Errorf("breaker %v after successful trial; want closed", state())
+	}
+	if got := p.Stats.BreakerTrips.Get(); got != 2 {
+		t.Errorf("BreakerTrips = %d; want 2", got)
+	}
+	if got := p.Stats.BreakerRejects.Get(); got != 1 {
+		t.Errorf("BreakerRejects = %d; want 1", got)
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", defaultBasePath+breakersPath, nil))
+	var states map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &states); err != nil {
+		t.Fatal(err)
+	}
+	if states[srv.URL] != "closed" {
+		t.Errorf("%s reported %v; want %s closed", breakersPath, states, srv.URL)
+	}
+}
+
+func TestBreakerSlowRequests(t *testing.T) {
+	b := new(breaker)
+	p := &HTTPPool{opts: HTTPPoolOptions{BreakerErrorRate: 1, BreakerWindow: 2, BreakerSlowAfter: time.Second}}
+	h := &httpGetter{pool: p, breaker: b}
+	h.breakerRecord(false, 2*time.Second)
+	h.breakerRecord(false, 2*time.Second)
+	if b.current() != BreakerOpen {
+		t.Errorf("breaker %v after slow requests; want open", b.current())
+	}
+}
@@ -0,0 +1,152 @@
+// budget.go implements a memory budget shared by all groups.
+
+package groupcache
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// utilityHalfLife is how quickly past cache hits stop counting
+// towards a group's utility.
+const utilityHalfLife = time.Minute
+
+// budgetBatches is how many batches the budget is enforced in: groups
+// are trimmed to fit in all but one batch's worth of it, and trimmed
+// again once that much more has been cached.
+const budgetBatches = 64
+
+// Lock order: budgetMu is taken before mu, and never while holding mu
+// or the lock of a group or cache.
+var (
+	budgetMu    sync.Mutex // serializes enforcement of budgetBytes
+	budgetBytes int64      // accessed atomically
+	budgetAdded int64      // accessed atomically; bytes cached since enforcement
+)
+
+// SetMemoryBudget limits the combined size of the caches of all
+// registered groups to n bytes. Each group's own cacheBytes limit
+// still applies within the budget.
+//
+// When the budget is exceeded, entries are evicted from the group with
+// the lowest utility: its recent cache hits per byte cached, with hits
+// counting half as much for every minute since they happened. Space
+// thus flows to whichever groups currently make the best use of it.
+// Rather than on every insertion, the budget is enforced each time a
+// 64th of it has been cached, by trimming the groups to 63/64ths of it.
+//
+// A budget of zero or less removes the limit.
+func SetMemoryBudget(n int64) {
+	atomic.StoreInt64(&budgetBytes, n)
+	enforceMemoryBudget()
+}
+
+// MemoryBudget returns the limit set by SetMemoryBudget.
+func MemoryBudget() int64 {
+	return atomic.LoadInt64(&budgetBytes)
+}
+
+// budgetCached records that n bytes were just cached, enforcing the
+// memory budget once enough have been since it last was.
+func budgetCached(n int64) {
+	limit := MemoryBudget()
+	if limit <= 0 || atomic.AddInt64(&budgetAdded, n) < limit/budgetBatches {
+		return
+	}
+	enforceMemoryBudget()
+}
+
+// enforceMemoryBudget evicts entries across groups until their caches
+// fit in the memory budget, less a batch to fill before it is enforced
+// again.
+func enforceMemoryBudget() {
+	limit := MemoryBudget()
+	if limit <= 0 {
+		return
+	}
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	atomic.StoreInt64(&budgetAdded, 0)
+	target := limit - limit/budgetBatches
+
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+
+	for {
+		var (
+			total  int64
+			victim *Group
+			min    float64
+		)
+		for _, g := range gs {
+			n := g.cachedBytes()
+			if n == 0 {
+				continue
+			}
+			total += n
+			if u := g.util.value() / float64(n); victim == nil || u < min {
+				victim, min = g, u
+			}
+		}
+		if total <= target {
+			return
+		}
+		victim.removeOldest()
+	}
+}
+
+// BudgetShare describes a group's part of the memory budget.
+type BudgetShare struct {
+	Bytes   int64   // size of the group's caches
+	Share   float64 // fraction of the budget used; zero without a budget
+	Utility float64 // recent cache hits per byte
+}
+
+// BudgetShare returns the group's current part of the memory budget
+// set by SetMemoryBudget.
+func (g *Group) BudgetShare() BudgetShare {
+	s := BudgetShare{Bytes: g.cachedBytes()}
+	if limit := MemoryBudget(); limit > 0 {
+		s.Share = float64(s.Bytes) / float64(limit)
+	}
+	if s.Bytes > 0 {
+		s.Utility = g.util.value() / float64(s.Bytes)
+	}
+	return s
+}
+
+// utility is a count of cache hits that decays exponentially with
+// utilityHalfLife. Hits are counted without locking, and decay from
+// when value, which enforcing the budget calls often, next sees them.
+type utility struct {
+	hits AtomicInt // all hits counted
+
+	mu      sync.Mutex // guards the rest
+	seen    int64      // hits already added to decayed
+	decayed float64
+	at      time.Time // when decayed was last decayed
+}
+
+func (u *utility) hit() {
+	u.hits.Add(1)
+}
+
+func (u *utility) value() float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := timeNow()
+	if !u.at.IsZero() {
+		u.decayed *= math.Exp2(-float64(now.Sub(u.at)) / float64(utilityHalfLife))
+	}
+	u.at = now
+	hits := u.hits.Get()
+	u.decayed += float64(hits - u.seen)
+	u.seen = hits
+	return u.decayed
+}
@@ -0,0 +1,116 @@
+package groupcache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetBudget removes the memory budget and forgets the hits of the
+// registered groups, so that budget tests, and repeated runs of them,
+// do not see each other's hits or fake times.
+func resetBudget() {
+	SetMemoryBudget(0)
+	atomic.StoreInt64(&budgetAdded, 0)
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, g := range groups {
+		u := &g.util
+		u.mu.Lock()
+		u.seen, u.decayed, u.at = u.hits.Get(), 0, time.Time{}
+		u.mu.Unlock()
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+	resetBudget()
+	defer resetBudget()
+
+	getter := GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value-of-" + key)
+	})
+	hot := NewGroupOpts("TestMemoryBudget-hot", cacheSize, getter, &GroupOptions{Peers: NoPeers{}})
+	cold := NewGroupOpts("TestMemoryBudget-cold", cacheSize, getter, &GroupOptions{Peers: NoPeers{}})
+	defer DeregisterGroup(hot.Name())
+	defer DeregisterGroup(cold.Name())
+	get := func(g *Group, key string) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The hot group caches a few keys that are read over and over.
+	for i := 0; i < 100; i++ {
+		get(hot, fmt.Sprintf("key-%d", i%4))
+	}
+	hotBytes := hot.cachedBytes()
+
+	const limit = 1 << 12
+	SetMemoryBudget(limit)
+
+	// The cold group streams through keys it never reads again.
+	for i := 0; i < 1000; i++ {
+		get(cold, fmt.Sprintf("key-%d", i))
+	}
+
+	if total := hot.cachedBytes() + cold.cachedBytes(); total > limit {
+		t.Errorf("groups cache %d bytes; want at most %d", total, limit)
+	}
+	if got := hot.cachedBytes(); got != hotBytes {
+		t.Errorf("hot group caches %d bytes; want all %d kept", got, hotBytes)
+	}
+	share := cold.BudgetShare()
+	if share.Bytes == 0 || share.Share <= 0 || share.Share > 1 {
+		t.Errorf("cold group share = %+v; want a part of the budget", share)
+	}
+	if hs := hot.BudgetShare(); hs.Utility <= share.Utility {
+		t.Errorf("hot utility %v <= cold utility %v", hs.Utility, share.Utility)
+	}
+
+	// Once the hot group's hits are long past, it loses its claim.
+	now = now.Add(time.Hour)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		get(cold, key)
+		get(cold, key)
+	}
+	if got := hot.cachedBytes(); got >= hotBytes {
+		t.Errorf("idle hot group still caches %d bytes", got)
+	}
+}
+
+func TestMemoryBudgetBatches(t *testing.T) {
+	resetBudget()
+	defer resetBudget()
+	g := NewGroupOpts("TestMemoryBudgetBatches-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetBytes(make([]byte, 100))
+	}), &GroupOptions{Peers: NoPeers{}})
+	defer DeregisterGroup(g.Name())
+
+	const limit = 1 << 20
+	SetMemoryBudget(limit)
+	batch := int64(limit / budgetBatches)
+	enforced := 0
+	for i := 0; i < 2000; i++ {
+		before := atomic.LoadInt64(&budgetAdded)
+		var b []byte
+		if err := g.Get(dummyCtx, fmt.Sprint("key-", i), AllocatingByteSliceSink(&b)); err != nil {
+			t.Fatal(err)
+		}
+		after := atomic.LoadInt64(&budgetAdded)
+		if after < before {
+			enforced++
+		}
+		if after >= batch {
+			t.Fatalf("%d bytes cached since the budget was enforced; want less than a batch of %d", after, batch)
+		}
+	}
+	// About 220KB were cached, in batches of 16KB.
+	if enforced < 10 || enforced > 20 {
+		t.Errorf("budget enforced %d times for 2000 insertions; want once per batch", enforced)
+	}
+}
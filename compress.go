@@ -0,0 +1,218 @@
+// compress.go compresses values, both on the wire between peers, as
+// negotiated through the Accept-Encoding and Content-Encoding headers,
+// and optionally in a group's mainCache.
+
+package groupcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultCompressMinBytes is the size below which values are not
+// compressed unless configured otherwise.
+const defaultCompressMinBytes = 1024
+
+// A codec is a compression format, named as in HTTP's Content-Encoding.
+type codec struct {
+	name   string
+	encode func(src []byte) []byte
+	// decode decompresses src, failing with errValueTooLarge
+	// rather than producing more than max bytes, if max is
+	// positive.
+	decode func(src []byte, max int64) ([]byte, error)
+}
+
+var codecs = map[string]*codec{
+	"gzip":   {name: "gzip", encode: gzipEncode, decode: gzipDecode},
+	"zstd":   {name: "zstd", encode: zstdEncode, decode: zstdDecode},
+	"snappy": {name: "snappy", encode: snappyEncode, decode: snappyDecode},
+}
+
+// lookupCodec returns the named codec, panicking if there is no such
+// codec, which is a configuration error.
+func lookupCodec(name string) *codec {
+	c, ok := codecs[name]
+	if !ok {
+		panic(fmt.Sprintf("groupcache: unknown compression %q", name))
+	}
+	return c
+}
+
+// compress returns src compressed with c, and whether that saved
+// anything. Inputs shorter than minBytes are left alone.
+func (c *codec) compress(src []byte, minBytes int) ([]byte, bool) {
+	if minBytes <= 0 {
+		minBytes = defaultCompressMinBytes
+	}
+	if len(src) < minBytes {
+		return src, false
+	}
+	dst := c.encode(src)
+	if len(dst) >= len(src) {
+		return src, false
+	}
+	return dst, true
+}
+
+func gzipEncode(src []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(src)
+	w.Close()
+	return b.Bytes()
+}
+
+func gzipDecode(src []byte, max int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return readMax(r, max)
+}
+
+// readMax reads r to the end, failing with errValueTooLarge once it
+// has read more than max bytes, if max is positive.
+func readMax(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(b)) > max {
+		return nil, errValueTooLarge
+	}
+	return b, err
+}
+
+var (
+	zstdOnce sync.Once
+	zstdEnc  *zstd.Encoder
+	zstdDec  *zstd.Decoder
+
+	// zstdStreams holds the *zstd.Decoders that decode with a
+	// limit, which, unlike zstdDec's DecodeAll, are used by one
+	// goroutine at a time.
+	zstdStreams sync.Pool
+)
+
+// zstdInit creates the zstd encoder and decoder, which are safe for
+// concurrent use, on first use.
+func zstdInit() {
+	zstdOnce.Do(func() {
+		zstdEnc, _ = zstd.NewWriter(nil)
+		zstdDec, _ = zstd.NewReader(nil)
+	})
+}
+
+func zstdEncode(src []byte) []byte {
+	zstdInit()
+	return zstdEnc.EncodeAll(src, nil)
+}
+
+func zstdDecode(src []byte, max int64) ([]byte, error) {
+	if max <= 0 {
+		zstdInit()
+		return zstdDec.DecodeAll(src, nil)
+	}
+	d, _ := zstdStreams.Get().(*zstd.Decoder)
+	if d == nil {
+		var err error
+		if d, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1)); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.Reset(bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+	b, err := readMax(d, max)
+	d.Reset(nil)
+	zstdStreams.Put(d)
+	return b, err
+}
+
+func snappyEncode(src []byte) []byte { return snappy.Encode(nil, src) }
+
+func snappyDecode(src []byte, max int64) ([]byte, error) {
+	// The decoded length heads the block, and Decode checks it.
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(n) > max {
+		return nil, errValueTooLarge
+	}
+	return snappy.Decode(nil, src)
+}
+
+// acceptEncoding returns the Accept-Encoding header with which the
+// pool asks peers for compressed responses, or "" if it does not.
+func (p *HTTPPool) acceptEncoding() string {
+	return strings.Join(p.opts.Compression, ", ")
+}
+
+// negotiateCodec returns the first codec listed in accept, an
+// Accept-Encoding header, that the pool compresses with, or nil if
+// there is none.
+func (p *HTTPPool) negotiateCodec(accept string) *codec {
+	if accept == "" || len(p.opts.Compression) == 0 {
+		return nil
+	}
+	for _, coding := range strings.Split(accept, ",") {
+		name, params := coding, ""
+		if i := strings.Index(coding, ";"); i >= 0 {
+			name, params = coding[:i], coding[i+1:]
+		}
+		name = strings.TrimSpace(name)
+		if q := strings.TrimSpace(params); strings.HasPrefix(q, "q=") {
+			if w, err := strconv.ParseFloat(q[len("q="):], 64); err == nil && w == 0 {
+				continue // explicitly refused
+			}
+		}
+		for _, ours := range p.opts.Compression {
+			if ours == name {
+				return lookupCodec(name)
+			}
+		}
+	}
+	return nil
+}
+
+// compressResponse compresses body, a response to a request that
+// accepts the given encodings, if that is worthwhile. It returns the
+// body to send and its Content-Encoding, if any.
+func (p *HTTPPool) compressResponse(accept string, body []byte) ([]byte, string) {
+	c := p.negotiateCodec(accept)
+	if c == nil {
+		return body, ""
+	}
+	out, ok := c.compress(body, p.opts.CompressMinBytes)
+	if !ok {
+		return body, ""
+	}
+	p.Stats.CompressedResponses.Add(1)
+	p.Stats.CompressionSaved.Add(int64(len(body) - len(out)))
+	return out, c.name
+}
+
+// decompressResponse decodes body, a response from a peer with the
+// given Content-Encoding, failing with errValueTooLarge if it would
+// exceed max bytes, if max is positive.
+func decompressResponse(encoding string, body []byte, max int64) ([]byte, error) {
+	if encoding == "" || encoding == "identity" {
+		return body, nil
+	}
+	c, ok := codecs[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	return c.decode(body, max)
+}
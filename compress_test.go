@@ -0,0 +1,172 @@
+package groupcache
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodecs(t *testing.T) {
+	raw := []byte(strings.Repeat("groupcache ", 500))
+	for name, c := range codecs {
+		packed, ok := c.compress(raw, 0)
+		if !ok {
+			t.Errorf("%s: compressing %d repetitive bytes saved nothing", name, len(raw))
+			continue
+		}
+		got, err := c.decode(packed, 0)
+		if err != nil || !bytes.Equal(got, raw) {
+			t.Errorf("%s: round trip = %d bytes, %v; want the original %d bytes", name, len(got), err, len(raw))
+		}
+		if got, err := c.decode(packed, int64(len(raw))); err != nil || !bytes.Equal(got, raw) {
+			t.Errorf("%s: round trip at the limit = %d bytes, %v; want the original %d bytes", name, len(got), err, len(raw))
+		}
+		if _, err := c.decode(packed, int64(len(raw)-1)); err != errValueTooLarge {
+			t.Errorf("%s: decoding past the limit = %v; want errValueTooLarge", name, err)
+		}
+		if _, ok := c.compress(raw[:100], 0); ok {
+			t.Errorf("%s: compressed 100 bytes, below the default minimum", name)
+		}
+	}
+}
+
+// encodingRecorder records the Content-Encoding of the responses to
+// Gets it passes on.
+type encodingRecorder struct {
+	encodings []string
+}
+
+func (r *encodingRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && !strings.HasSuffix(req.URL.Path, helloPath) {
+		r.encodings = append(r.encodings, res.Header.Get("Content-Encoding"))
+	}
+	return res, err
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	value := strings.Repeat("compressible ", 1000)
+	server := &HTTPPool{opts: HTTPPoolOptions{
+		BasePath:    defaultBasePath,
+		Compression: []string{"zstd", "gzip"},
+	}}
+	g := NewGroupOpts("TestCompressionNegotiation-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		if key == "small" {
+			return dest.SetString("tiny")
+		}
+		return dest.SetString(value)
+	}), &GroupOptions{Peers: server})
+	defer DeregisterGroup(g.Name())
+	server.Set()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	tests := []struct {
+		compression []string
+		key         string
+		want        string // Content-Encoding
+	}{
+		{[]string{"zstd", "snappy", "gzip"}, "big", "zstd"},
+		{[]string{"snappy", "gzip"}, "big", "gzip"},
+		{[]string{"snappy"}, "big", ""},
+		{nil, "big", ""},
+		{[]string{"gzip"}, "small", ""},
+	}
+	for _, tt := range tests {
+		rec := new(encodingRecorder)
+		client := &HTTPPool{
+			Transport: func(Context) http.RoundTripper { return rec },
+			opts:      HTTPPoolOptions{BasePath: defaultBasePath, Compression: tt.compression},
+		}
+		client.Set(srv.URL)
+		out := new(pb.GetResponse)
+		in := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String(tt.key)}
+		if err := client.httpGetters[srv.URL].Get(nil, in, out); err != nil {
+			t.Errorf("client accepting %v: %v", tt.compression, err)
+			continue
+		}
+		if want := map[bool]string{true: "tiny", false: value}[tt.key == "small"]; string(out.Value) != want {
+			t.Errorf("client accepting %v got a value of %d bytes; want %d", tt.compression, len(out.Value), len(want))
+		}
+		if len(rec.encodings) != 1 || rec.encodings[0] != tt.want {
+			t.Errorf("client accepting %v got Content-Encoding %q; want %q", tt.compression, rec.encodings, tt.want)
+		}
+	}
+	// Without Compression, the client's http.Transport asks for gzip
+	// itself, and decompresses the response out of sight.
+	if got := server.Stats.CompressedResponses.Get(); got != 3 {
+		t.Errorf("CompressedResponses = %d; want 3", got)
+	}
+	if got := server.Stats.CompressionSaved.Get(); got < int64(len(value)) {
+		t.Errorf("CompressionSaved = %d; want at least %d", got, len(value))
+	}
+}
+
+func TestCacheCompression(t *testing.T) {
+	value := strings.Repeat("compressible ", 1000)
+	g := NewGroupOpts("TestCacheCompression-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		if key == "small" {
+			return dest.SetString("tiny")
+		}
+		return dest.SetString(value)
+	}), &GroupOptions{CacheCompression: "snappy"})
+	defer DeregisterGroup(g.Name())
+
+	for i := 0; i < 2; i++ {
+		for _, key := range []string{"big", "small"} {
+			var got string
+			if err := g.Get(nil, key, StringSink(&got)); err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]string{true: "tiny", false: value}[key == "small"]; got != want {
+				t.Errorf("Get(%q) = %d bytes; want %d", key, len(got), len(want))
+			}
+		}
+	}
+	if got := g.Stats.LocalLoads.Get(); got != 2 {
+		t.Errorf("LocalLoads = %d; want 2", got)
+	}
+	st := g.CacheStats(MainCache)
+	if st.Saved <= 0 || st.Bytes >= int64(len(value)) {
+		t.Errorf("CacheStats = %+v; want the value stored compressed", st)
+	}
+
+	var snap bytes.Buffer
+	if err := g.Snapshot(&snap); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(snap.Bytes(), []byte(value)) {
+		t.Error("snapshot does not hold the decompressed value")
+	}
+
+	g.Clear()
+	if st := g.CacheStats(MainCache); st.Saved != 0 {
+		t.Errorf("Saved = %d after Clear; want 0", st.Saved)
+	}
+}
+
+func TestDecompressedMaxValueBytes(t *testing.T) {
+	b, _ := proto.Marshal(&pb.GetResponse{Value: make([]byte, 8<<20)})
+	bomb := gzipEncode(b)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, helloPath) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	}))
+	defer srv.Close()
+
+	client := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, MaxValueBytes: 1 << 10}}
+	client.Set(srv.URL)
+	res := new(pb.GetResponse)
+	if err := client.httpGetters[srv.URL].Get(nil, &pb.GetRequest{Group: new(string), Key: new(string)}, res); err != errValueTooLarge {
+		t.Errorf("Get of a %d byte response inflating to %d = %v; want %v", len(bomb), len(b), err, errValueTooLarge)
+	}
+}
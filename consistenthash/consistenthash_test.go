@@ -108,3 +108,26 @@ func benchmarkGet(b *testing.B, shards int) {
 		hash.Get(buckets[i&(shards-1)])
 	}
 }
+
+func TestHashN(t *testing.T) {
+	m := NewmpcHash(60, 1, siphash64seed, [2]uint64{1, 2}, 21)
+	m.Add("a", "b", "c", "d")
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		got := m.HashN(key, 3)
+		if len(got) != 3 {
+			t.Fatalf("HashN(%q, 3) = %v; want 3 buckets", key, got)
+		}
+		if got[0] != m.Hash(key)[0] {
+			t.Errorf("HashN(%q, 3)[0] = %q; want Hash's %q", key, got[0], m.Hash(key)[0])
+		}
+		if got[0] == got[1] || got[0] == got[2] || got[1] == got[2] {
+			t.Errorf("HashN(%q, 3) = %v; want distinct buckets", key, got)
+		}
+	}
+
+	if got := m.HashN("key", 10); len(got) > 4 {
+		t.Errorf("HashN with 4 buckets returned %v", got)
+	}
+}
@@ -1,7 +1,6 @@
 package consistenthash
 
 import (
-	"fmt"
 	"math"
 	"sort"
 )
@@ -64,7 +63,7 @@ func NewmpcHash(bucketLen int, replicas int, h func(b []byte, s uint64) uint64,
 
 // Returns true if there are no items available.
 func (m *Multi) IsEmpty() bool {
-	return len(m.buckets) == 0
+	return len(m.bmap) == 0
 }
 
 func (m *Multi) Add(buckets ...string) {
@@ -83,14 +82,20 @@ func (m *Multi) Add(buckets ...string) {
 
 // Hash returns the bucket for a given key
 func (m *Multi) Hash(key string) []string {
-	fmt.Println("hash..............")
-	bkey := []byte(key)
+	return m.HashN(key, m.replicas)
+}
 
-	minDistance := uint64(math.MaxUint64)
+// HashN returns up to n distinct buckets for key, in order of
+// preference.
+func (m *Multi) HashN(key string, n int) []string {
+	if m.IsEmpty() || n <= 0 {
+		return nil
+	}
+	bkey := []byte(key)
 
-	selectedNodes := make([]Node, m.replicas)
-	for i := 0; i < m.replicas; i++ {
-		selectedNodes[i].distance = minDistance
+	selectedNodes := make([]Node, n)
+	for i := 0; i < n; i++ {
+		selectedNodes[i].distance = math.MaxUint64
 	}
 	distanceFunc := func(n1, n2 *Node) bool {
 		return n1.distance < n2.distance
@@ -129,18 +134,45 @@ func (m *Multi) Hash(key string) []string {
 		}
 
 		distance := node - hash
-		if distance < selectedNodes[m.replicas-1].distance {
-			selectedNodes[m.replicas-1].distance = distance
-			selectedNodes[m.replicas-1].hash = node
+		// Several probes may land on the same node; it keeps
+		// its closest distance rather than taking two places.
+		slot := n - 1
+		for j := range selectedNodes {
+			if selectedNodes[j].selected && selectedNodes[j].hash == node {
+				slot = j
+				break
+			}
+		}
+		if distance < selectedNodes[slot].distance {
+			selectedNodes[slot].distance = distance
+			selectedNodes[slot].hash = node
+			selectedNodes[slot].selected = true
 			By(distanceFunc).Sort(selectedNodes)
-			//			minDistance = distance
-			//			minhash = node
 		}
 	}
 
 	var results []string
-	for i := 0; i < m.replicas; i++ {
+	chosen := make(map[uint64]bool, n)
+	for i := 0; i < n && selectedNodes[i].selected; i++ {
 		results = append(results, m.bmap[selectedNodes[i].hash])
+		chosen[selectedNodes[i].hash] = true
+	}
+
+	// The probes may have found fewer than n distinct buckets; fill
+	// in with those following the preferred one around the ring.
+	if len(results) < n && len(results) < len(m.bmap) {
+		var ring []uint64
+		for _, v := range m.bhashes {
+			ring = append(ring, v...)
+		}
+		start := sort.Search(len(ring), func(i int) bool { return ring[i] >= selectedNodes[0].hash })
+		for i := 1; i < len(ring) && len(results) < n; i++ {
+			h := ring[(start+i)%len(ring)]
+			if !chosen[h] {
+				results = append(results, m.bmap[h])
+				chosen[h] = true
+			}
+		}
 	}
 	return results
 }
@@ -148,6 +180,7 @@ func (m *Multi) Hash(key string) []string {
 type Node struct {
 	hash     uint64
 	distance uint64
+	selected bool
 }
 
 // By is the type of a "less" function that defines the ordering of its Planet arguments.
@@ -0,0 +1,95 @@
+// errors.go classifies failed loads with a pb.ErrorCode, so that
+// peers can report them and callers can tell whether retrying might
+// help.
+
+package groupcache
+
+import (
+	"errors"
+	"net/http"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrOverloaded may be returned, possibly wrapped, by a Getter to
+	// report that it is too busy to load a key. A later retry may
+	// succeed. A peer reporting it counts as a failed peer: the key
+	// is then loaded from another peer or locally.
+	ErrOverloaded = errors.New("groupcache: overloaded")
+
+	// ErrUnauthorized may be returned, possibly wrapped, by a Getter
+	// to report that loading a key was refused. Retrying will not
+	// help.
+	ErrUnauthorized = errors.New("groupcache: unauthorized")
+)
+
+// Errors reported by peers match ErrNotFound, ErrOverloaded and
+// ErrUnauthorized with errors.Is according to their code. Other
+// failed loads are backend errors.
+var codeErrors = map[pb.ErrorCode]error{
+	pb.ErrorCode_ERR_NOT_FOUND:    ErrNotFound,
+	pb.ErrorCode_ERR_OVERLOADED:   ErrOverloaded,
+	pb.ErrorCode_ERR_UNAUTHORIZED: ErrUnauthorized,
+}
+
+// errorCode returns the code classifying err, a failed load.
+func errorCode(err error) pb.ErrorCode {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return pb.ErrorCode_ERR_NOT_FOUND
+	case errors.Is(err, ErrOverloaded):
+		return pb.ErrorCode_ERR_OVERLOADED
+	case errors.Is(err, ErrUnauthorized):
+		return pb.ErrorCode_ERR_UNAUTHORIZED
+	}
+	return pb.ErrorCode_ERR_BACKEND
+}
+
+// isCode reports whether target is the error matching code.
+func isCode(code pb.ErrorCode, target error) bool {
+	e, ok := codeErrors[code]
+	return ok && target == e
+}
+
+// A codeError is an error reported by a peer other than in a
+// GetResponse, such as by the status of its response.
+type codeError struct {
+	code pb.ErrorCode
+	msg  string
+}
+
+func (e *codeError) Error() string { return e.msg }
+
+func (e *codeError) Is(target error) bool { return isCode(e.code, target) }
+
+// httpStatusCodes classifies the statuses of HTTP responses.
+var httpStatusCodes = map[int]pb.ErrorCode{
+	http.StatusUnauthorized:       pb.ErrorCode_ERR_UNAUTHORIZED,
+	http.StatusForbidden:          pb.ErrorCode_ERR_UNAUTHORIZED,
+	http.StatusTooManyRequests:    pb.ErrorCode_ERR_OVERLOADED,
+	http.StatusServiceUnavailable: pb.ErrorCode_ERR_OVERLOADED,
+}
+
+// grpcError returns err, the failure of a gRPC call, classified by
+// its status code.
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return &codeError{code: pb.ErrorCode_ERR_UNAUTHORIZED, msg: err.Error()}
+	case codes.ResourceExhausted:
+		return &codeError{code: pb.ErrorCode_ERR_OVERLOADED, msg: err.Error()}
+	}
+	return err
+}
+
+// finalPeerError reports whether err, returned by getFromPeer, is the
+// peer's answer for good: the key failed to load there, and loading it
+// elsewhere would fail too. An overloaded peer's is not; the key is
+// then loaded from another peer or locally.
+func finalPeerError(err error) bool {
+	le, ok := err.(*loadError)
+	return ok && le.code != pb.ErrorCode_ERR_OVERLOADED
+}
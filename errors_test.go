@@ -0,0 +1,146 @@
+package groupcache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPeerErrorCodes(t *testing.T) {
+	server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	owner := NewGroupOpts("TestPeerErrorCodes-owner", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		switch key {
+		case "missing":
+			return fmt.Errorf("no row: %w", ErrNotFound)
+		case "denied":
+			return ErrUnauthorized
+		}
+		return errors.New("database on fire")
+	}), &GroupOptions{Peers: server})
+	defer DeregisterGroup(owner.Name())
+	server.Set()
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	client := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	client.Set(srv.URL)
+	peer := &renamedPeer{h: client.httpGetters[srv.URL], group: owner.Name()}
+	g := NewGroupOpts("TestPeerErrorCodes-caller", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		t.Errorf("loaded %q locally", key)
+		return dest.SetString("local")
+	}), &GroupOptions{Peers: rankedPeers{peer}})
+	defer DeregisterGroup(g.Name())
+
+	all := []error{ErrNotFound, ErrOverloaded, ErrUnauthorized}
+	for _, tt := range []struct {
+		key  string
+		want error // nil for a backend error
+		msg  string
+	}{
+		{"missing", ErrNotFound, "no row"},
+		{"denied", ErrUnauthorized, "groupcache: unauthorized"},
+		{"other", nil, "database on fire"},
+	} {
+		var s string
+		err := g.Get(nil, tt.key, StringSink(&s))
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Get(%q) = %v; want an error containing %q", tt.key, err, tt.msg)
+			continue
+		}
+		for _, target := range all {
+			if errors.Is(err, target) != (target == tt.want) {
+				t.Errorf("Get(%q) = %v; errors.Is(err, %v) = %v", tt.key, err, target, !(target == tt.want))
+			}
+		}
+	}
+	if got := g.Stats.PeerErrors.Get(); got != 0 {
+		t.Errorf("PeerErrors = %d; want 0, as the owner answered", got)
+	}
+}
+
+// overloadedPeer answers every Get as overloaded.
+type overloadedPeer struct{}
+
+func (overloadedPeer) Get(_ Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	out.Error = proto.String("database: groupcache: overloaded")
+	out.ErrorCode = pb.ErrorCode_ERR_OVERLOADED.Enum()
+	return nil
+}
+
+func TestOverloadedPeer(t *testing.T) {
+	g := &Group{name: "TestOverloadedPeer"}
+	if err := g.peerLoadError("k", &pb.GetResponse{Error: proto.String("busy"), ErrorCode: pb.ErrorCode_ERR_OVERLOADED.Enum()}); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("overloaded peer's error = %v; want it to match ErrOverloaded", err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		peers rankedPeers
+		want  string
+	}{
+		{"fallback", rankedPeers{overloadedPeer{}, &fakePeer{}}, "got:k"},
+		{"local", rankedPeers{overloadedPeer{}}, "local"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGroupOpts("TestOverloadedPeer-"+tt.name, 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+				return dest.SetString("local")
+			}), &GroupOptions{Peers: tt.peers, PeerFallbacks: 1})
+			defer DeregisterGroup(g.Name())
+
+			var s string
+			if err := g.Get(nil, "k", StringSink(&s)); err != nil || s != tt.want {
+				t.Errorf("Get = %q, %v; want %q", s, err, tt.want)
+			}
+			if got := g.Stats.PeerErrors.Get(); got != 1 {
+				t.Errorf("PeerErrors = %d; want 1 for the overloaded peer", got)
+			}
+			if errs := g.RecentPeerErrors(); len(errs) != 1 {
+				t.Errorf("recent peer errors = %v; want the overloaded peer's", errs)
+			}
+		})
+	}
+}
+
+func TestLegacyPeerLoadError(t *testing.T) {
+	g := &Group{name: "TestLegacyPeerLoadError"}
+	err := g.peerLoadError("k", &pb.GetResponse{Error: proto.String("gone"), NotFound: proto.Bool(true)})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("legacy not found = %v; want it to match ErrNotFound", err)
+	}
+	err = g.peerLoadError("k", &pb.GetResponse{Error: proto.String("broken")})
+	if err.code != pb.ErrorCode_ERR_BACKEND || errors.Is(err, ErrNotFound) {
+		t.Errorf("legacy error has code %v; want %v", err.code, pb.ErrorCode_ERR_BACKEND)
+	}
+}
+
+func TestStatusErrorCodes(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+		{http.StatusServiceUnavailable, ErrOverloaded},
+		{http.StatusTooManyRequests, ErrOverloaded},
+		{http.StatusInternalServerError, nil},
+	} {
+		rec := httptest.NewRecorder()
+		httpError(rec, tt.status, "code", "details")
+		res := rec.Result()
+		err := statusError(res)
+		if !strings.Contains(err.Error(), "details") {
+			t.Errorf("status %d: error %q lacks the message", tt.status, err)
+		}
+		for _, target := range []error{ErrOverloaded, ErrUnauthorized} {
+			if errors.Is(err, target) != (target == tt.want) {
+				t.Errorf("status %d: errors.Is(%v, %v) = %v", tt.status, err, target, !(target == tt.want))
+			}
+		}
+	}
+}
@@ -25,16 +25,18 @@ limitations under the License.
 package groupcache
 
 import (
+	"context"
 	"errors"
-	"log"
 	"math/rand"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	pb "github.com/golang/groupcache/groupcachepb"
 	"github.com/golang/groupcache/lru"
 	"github.com/golang/groupcache/singleflight"
+	"google.golang.org/protobuf/proto"
 )
 
 // A Getter loads data for a key.
@@ -55,6 +57,12 @@ func (f GetterFunc) Get(ctx Context, key string, dest Sink) error {
 	return f(ctx, key, dest)
 }
 
+// ErrNotFound may be returned, possibly wrapped, by a Getter to
+// report that a key does not exist. Errors served from the negative
+// cache, including those reported by peers, match it with errors.Is
+// when the original load failed with ErrNotFound.
+var ErrNotFound = errors.New("groupcache: not found")
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
@@ -72,6 +80,44 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// groupsUsing returns the registered groups that find their peers
+// through peers, one of the pools.
+func groupsUsing(peers PeerPicker) []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	var gs []*Group
+	for _, g := range groups {
+		g.peersOnce.Do(g.initPeers)
+		if g.peers == peers {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
+// forgetPeers tells the groups using peers, a pool whose Set has just
+// replaced its getters, that live are the getters now in use.
+func forgetPeers(peers PeerPicker, live []ProtoGetter) {
+	for _, g := range groupsUsing(peers) {
+		g.forgetPeers(live)
+	}
+}
+
+// DeregisterGroup removes the named group, so that GetGroup and peer
+// requests no longer find it and its name may be used again by
+// NewGroup. Callers still holding the *Group may keep using it.
+// It reports whether the group was registered.
+func DeregisterGroup(name string) bool {
+	mu.Lock()
+	g, ok := groups[name]
+	delete(groups, name)
+	mu.Unlock()
+	if ok {
+		g.stopBackground()
+	}
+	return ok
+}
+
 // NewGroup creates a coordinated group-aware Getter from a Getter.
 //
 // The returned Getter tries (but does not guarantee) to run only one
@@ -85,11 +131,129 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 	return newGroup(name, cacheBytes, getter, nil)
 }
 
-// If peers is nil, the peerPicker is called via a sync.Once to initialize it.
-func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
+// GroupOptions are the configurations of a Group.
+type GroupOptions struct {
+	// Peers optionally specifies the PeerPicker that finds the
+	// group's peers, binding the group to it. If nil, the
+	// PeerPicker registered with RegisterPeerPicker or
+	// RegisterPerGroupPeerPicker is used. Group names are unique
+	// across the process, whatever their peers.
+	Peers PeerPicker
+
+	// Tracer, if non-nil, observes the steps of the group's Gets.
+	Tracer Tracer
+
+	// Logger, if non-nil, receives the group's log messages at
+	// LogLevel and above. By default nothing is logged.
+	Logger   Logger
+	LogLevel LogLevel
+
+	// LogValues makes log messages carry values in full; by default
+	// only their size is logged.
+	LogValues bool
+
+	// NegativeCacheTTL specifies how long a failed load of a key is
+	// remembered. While the failure is cached, Gets of the key
+	// return the same error without calling the Getter or a peer.
+	// Loads cut short by their Context are never cached. If zero,
+	// load errors are not cached.
+	NegativeCacheTTL time.Duration
+
+	// SoftTTL specifies how long a loaded value is fresh. A Get of
+	// a value older than SoftTTL still returns it immediately, but
+	// also starts a background reload of the key; concurrent
+	// reloads of a key are deduplicated like any other load.
+	// If zero, values never become stale.
+	SoftTTL time.Duration
+
+	// HardTTL specifies how long a loaded value may be served at
+	// all. Once it has passed, Gets block on a reload as if the
+	// value had never been cached. If zero, values never expire.
+	HardTTL time.Duration
+
+	// SnapshotDir optionally specifies a directory in which the
+	// group's mainCache is saved every SnapshotInterval, and
+	// when the group is deregistered. A new group restores the
+	// last such snapshot, so that a restarted peer starts warm.
+	SnapshotDir string
+
+	// SnapshotInterval specifies how often the group is saved to
+	// SnapshotDir. If zero, it defaults to one minute.
+	SnapshotInterval time.Duration
+
+	// PeerFallbacks specifies how many more of a key's owners, in
+	// order of preference, to try when its preferred owner fails,
+	// before loading the key locally. It requires the group's
+	// PeerPicker to be a MultiPeerPicker.
+	PeerFallbacks int
+
+	// PeerEjectAfter, if positive, is the number of consecutive
+	// errors after which a peer is skipped for PeerEjectFor, as if
+	// it were absent from the pool. Peers are told apart by
+	// comparing their ProtoGetters, which must be comparable.
+	PeerEjectAfter int
+
+	// PeerEjectFor specifies how long an ejected peer is skipped.
+	// If zero, it defaults to 30 seconds.
+	PeerEjectFor time.Duration
+
+	// HedgeAfter, if positive, enables hedged loads: when a peer
+	// has not answered within HedgeAfter, the load is also sent to
+	// the key's next owner (see PeerFallbacks), or made locally if
+	// there is none, and the first success wins. When the Context
+	// is nil or a context.Context, the losing requests are canceled
+	// through a context derived from it.
+	HedgeAfter time.Duration
+
+	// HedgeAtP95, if set, hedges a load from a peer once that
+	// peer's observed 95th percentile latency has passed, rather
+	// than HedgeAfter. HedgeAfter still applies until the peer has
+	// answered enough loads.
+	HedgeAtP95 bool
+
+	// CacheCompression, if set, names the compression, of "zstd",
+	// "snappy" and "gzip", with which values are stored in
+	// mainCache, so that more of them fit in cacheBytes. They are
+	// decompressed on every cache hit, trading CPU for memory.
+	CacheCompression string
+
+	// CacheCompressMinBytes specifies the size below which values
+	// are stored uncompressed. If zero, it defaults to 1024.
+	CacheCompressMinBytes int
+}
+
+// NewGroupOpts is like NewGroup but configures the group with the
+// given options. A nil o is equivalent to NewGroup.
+func NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
+	return newGroup(name, cacheBytes, getter, o)
+}
+
+func newGroup(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
+	g := registerGroup(name, cacheBytes, getter, o)
+	if dir := g.opts.SnapshotDir; dir != "" {
+		// The snapshot is restored once the group is registered
+		// and mu released: restoring reads the disk, and enforcing
+		// the memory budget takes mu.
+		if err := g.restoreFile(dir); err != nil {
+			g.logger().log(LogError, "restoring snapshot failed", LogField{"group", name}, LogField{"error", err})
+		}
+		interval := g.opts.SnapshotInterval
+		if interval <= 0 {
+			interval = defaultSnapshotInterval
+		}
+		go func() {
+			defer close(g.stopped)
+			g.snapshotLoop(dir, interval, g.stop)
+		}()
+	}
+	return g
+}
+
+// registerGroup creates and registers a group.
+func registerGroup(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
 	mu.Lock()
 	defer mu.Unlock()
 	initPeerServerOnce.Do(callInitPeerServer)
@@ -97,11 +261,28 @@ func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *G
 		panic("duplicate registration of group " + name)
 	}
 	g := &Group{
-		name:       name,
-		getter:     getter,
-		peers:      peers,
-		cacheBytes: cacheBytes,
-		loadGroup:  &singleflight.Group{},
+		name:         name,
+		getter:       getter,
+		cacheBytes:   cacheBytes,
+		loadGroup:    &singleflight.Group{},
+		localLatency: newHistogram(),
+		peerLatency:  newHistogram(),
+	}
+	if o != nil {
+		g.opts = *o
+	}
+	// If Peers is nil, the registered PeerPicker is called via
+	// a sync.Once to initialize it.
+	g.peers = g.opts.Peers
+	if name := g.opts.CacheCompression; name != "" {
+		g.mainCache.codec = lookupCodec(name)
+		g.mainCache.minBytes = g.opts.CacheCompressMinBytes
+	}
+	if g.opts.SnapshotDir != "" {
+		// Made now, so that a DeregisterGroup racing with the
+		// restore waits for the snapshot loop newGroup starts.
+		g.stop = make(chan struct{})
+		g.stopped = make(chan struct{})
 	}
 	if fn := newGroupHook; fn != nil {
 		fn(g)
@@ -110,6 +291,21 @@ func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *G
 	return g
 }
 
+const (
+	defaultSnapshotInterval = time.Minute
+	defaultPeerEjectFor     = 30 * time.Second
+)
+
+// stopBackground stops goroutines working on behalf of the group
+// and waits for them to finish.
+func (g *Group) stopBackground() {
+	g.stopRefreshes()
+	if g.stop != nil {
+		close(g.stop)
+		<-g.stopped
+	}
+}
+
 // newGroupHook, if non-nil, is called right after a new group is created.
 var newGroupHook func(*Group)
 
@@ -144,7 +340,8 @@ type Group struct {
 	getter     Getter
 	peersOnce  sync.Once
 	peers      PeerPicker
-	cacheBytes int64 // limit for sum of mainCache and hotCache size
+	cacheBytes int64 // limit for sum of mainCache and hotCache size; accessed atomically
+	opts       GroupOptions
 
 	// mainCache is a cache of the keys for which this process
 	// (amongst its peers) is authoritative. That is, this cache
@@ -167,6 +364,31 @@ type Group struct {
 	// concurrent callers.
 	loadGroup flightGroup
 
+	refreshMu      sync.Mutex
+	refreshing     map[string]context.CancelFunc // keys with a background reload running
+	refreshStopped bool                          // set by DeregisterGroup
+
+	// util tracks recent cache hits, to weigh the group's claim on
+	// the shared memory budget.
+	util utility
+
+	ejectMu sync.Mutex
+	ejects  map[ProtoGetter]*ejection // peers that failed lately
+
+	peerErrsMu sync.Mutex
+	peerErrs   map[string][]PeerError // recent errors of each peer, oldest first
+
+	latencyMu sync.Mutex
+	latencies map[ProtoGetter]*latencyWindow // for HedgeAtP95
+
+	// localLatency and peerLatency are histograms of how long local
+	// loads and fetches from peers take.
+	localLatency, peerLatency histogram
+
+	// stop, if non-nil, is closed when the group is deregistered,
+	// after which background goroutines close stopped.
+	stop, stopped chan struct{}
+
 	_ int32 // force Stats to be 8-byte aligned on 32-bit platforms
 
 	// Stats are statistics on the group.
@@ -187,11 +409,19 @@ type Stats struct {
 	CacheHits      AtomicInt // either cache was good
 	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
 	PeerErrors     AtomicInt
+	PeerFallbacks  AtomicInt // peer loads from other than the preferred owner
+	PeerEjections  AtomicInt // times a peer was ejected for failing
+	HedgesIssued   AtomicInt // duplicate loads sent after a slow peer
+	HedgesWon      AtomicInt // hedged loads that answered first
 	Loads          AtomicInt // (gets - cacheHits)
 	LoadsDeduped   AtomicInt // after singleflight
 	LocalLoads     AtomicInt // total good local loads
 	LocalLoadErrs  AtomicInt // total bad local loads
+	NegativeHits   AtomicInt // gets answered by a cached load error
+	StaleHits      AtomicInt // cache hits past SoftTTL
+	Refreshes      AtomicInt // background reloads started by stale hits
 	ServerRequests AtomicInt // gets that came over the network from peers
+	PeerStreams    AtomicInt // peer loads streamed into a WriterSink
 }
 
 // Name returns the name of the group.
@@ -205,38 +435,61 @@ func (g *Group) initPeers() {
 	}
 }
 
-func (g *Group) Get(ctx Context, key string, dest Sink) error {
-	log.Println("context=====!!!", ctx)
-	bv, err1 := dest.View()
-	log.Println("dest=====!!!", bv)
-	check(err1)
+func (g *Group) Get(ctx Context, key string, dest Sink) (err error) {
+	ctx, traceEnd := g.traceStart(ctx, key)
+	defer func() { traceEnd(err) }()
+	if ws, ok := dest.(*writerSink); ok {
+		return g.getStream(ctx, key, ws)
+	}
+	return g.get(ctx, key, dest)
+}
 
+// get is Get, but for streaming into a WriterSink and tracing.
+func (g *Group) get(ctx Context, key string, dest Sink) error {
 	g.peersOnce.Do(g.initPeers)
 	g.Stats.Gets.Add(1)
 	if dest == nil {
 		return errors.New("groupcache: nil dest Sink")
 	}
-	value, cacheHit := g.lookupCache(key)
+	e, cacheHit := g.lookupCache(key)
 
 	if cacheHit {
+		if e.err != nil {
+			g.Stats.NegativeHits.Add(1)
+			g.trace(ctx, TraceInfo{Event: TraceCacheHit, Key: key, Err: e.err})
+			return e.err
+		}
 		g.Stats.CacheHits.Add(1)
-		return setSinkView(dest, value)
+		g.trace(ctx, TraceInfo{Event: TraceCacheHit, Key: key, Bytes: e.value.Len()})
+		if e.stale(timeNow()) {
+			g.Stats.StaleHits.Add(1)
+			g.refresh(ctx, key)
+		}
+		return g.populateSink(ctx, key, dest, e.value)
 	}
+	g.trace(ctx, TraceInfo{Event: TraceCacheMiss, Key: key})
 
 	// Optimization to avoid double unmarshalling or copying: keep
 	// track of whether the dest was already populated. One caller
 	// (if local) will set this; the losers will not. The common
 	// case will likely be one caller.
 	destPopulated := false
-	log.Println("before loading...........")
-	value, destPopulated, err := g.load(ctx, key, dest)
+	value, destPopulated, err := g.load(ctx, key, dest, nil)
 	if err != nil {
 		return err
 	}
 	if destPopulated {
+		g.trace(ctx, TraceInfo{Event: TraceSinkPopulated, Key: key, Bytes: value.Len()})
 		return nil
 	}
-	return setSinkView(dest, value)
+	return g.populateSink(ctx, key, dest, value)
+}
+
+// populateSink sets value, that of key, into dest.
+func (g *Group) populateSink(ctx Context, key string, dest Sink, value ByteView) error {
+	err := setSinkView(dest, value)
+	g.trace(ctx, TraceInfo{Event: TraceSinkPopulated, Key: key, Bytes: value.Len(), Err: err})
+	return err
 }
 
 ////////////////overnest
@@ -247,15 +500,7 @@ func (g *Group) Save(ctx Context, key string, dest Sink) error {
 	var err error
 	value, err = dest.View()
 
-	peer1, ok1 := g.peers.PickPeer(key)
-
-	if ok1 {
-		log.Println(peer1)
-	}
-
-	if peer, ok := g.peers.PickPeer(key); ok {
-		log.Println("save.....before calling saveToPeer")
-		log.Println(value)
+	if peer, ok := g.peers.PickPeer(key); ok && supports(ctx, peer, pb.Capability_CAP_PUT) {
 		g.saveToPeer(ctx, peer, key, value.b)
 
 	} else {
@@ -271,9 +516,13 @@ func (g *Group) Save(ctx Context, key string, dest Sink) error {
 ////////////////////
 
 // load loads key either by invoking the getter locally or by sending it to another machine.
-func (g *Group) load(ctx Context, key string, dest Sink) (value ByteView, destPopulated bool, err error) {
+// It does not ask skip, if non-nil, a peer the caller has just seen fail.
+func (g *Group) load(ctx Context, key string, dest Sink, skip ProtoGetter) (value ByteView, destPopulated bool, err error) {
 	g.Stats.Loads.Add(1)
+	start := time.Now()
+	leader := false // whether this call runs the load, rather than joining one
 	viewi, err := g.loadGroup.Do(key, func() (interface{}, error) {
+		leader = true
 		// Check the cache again because singleflight can only dedup calls
 		// that overlap concurrently.  It's possible for 2 concurrent
 		// requests to miss the cache, resulting in 2 load() calls.  An
@@ -295,43 +544,278 @@ func (g *Group) load(ctx Context, key string, dest Sink) (value ByteView, destPo
 		// 1: fn()
 		// 2: loadGroup.Do("key", fn)
 		// 2: fn()
-		if value, cacheHit := g.lookupCache(key); cacheHit {
+		//
+		// A stale entry counts as a miss here, since reloading it
+		// is why we are here.
+		if e, cacheHit := g.lookupCache(key); cacheHit && !e.stale(timeNow()) {
+			if e.err != nil {
+				g.Stats.NegativeHits.Add(1)
+				return nil, e.err
+			}
 			g.Stats.CacheHits.Add(1)
-			return value, nil
+			return e.value, nil
 		}
 		g.Stats.LoadsDeduped.Add(1)
 		var value ByteView
 		var err error
-		if peer, ok := g.peers.PickPeer(key); ok {
-			log.Println("context=====222", ctx)
-			log.Println("pick a peer::::========", peer)
+		peers := g.pickPeers(key)
+		if skip != nil {
+			peers = withoutPeer(peers, skip)
+		}
+		if g.opts.HedgeAfter > 0 && len(peers) > 0 {
+			value, err = g.loadHedged(ctx, key, peers)
+			if err != nil {
+				return nil, err
+			}
+			return value, nil
+		}
+		for i, peer := range peers {
+			if g.ejected(peer) {
+				continue
+			}
 			value, err = g.getFromPeer(ctx, peer, key)
 			if err == nil {
+				g.peerSucceeded(peer)
 				g.Stats.PeerLoads.Add(1)
+				if i > 0 {
+					g.Stats.PeerFallbacks.Add(1)
+				}
 				return value, nil
 			}
+			if finalPeerError(err) {
+				// The peer answered; the key just failed to
+				// load there. Loading it here would fail too.
+				g.peerSucceeded(peer)
+				g.Stats.PeerLoads.Add(1)
+				return nil, err
+			}
 			g.Stats.PeerErrors.Add(1)
-			// TODO(bradfitz): log the peer's error? keep
-			// log of the past few for /groupcachez?  It's
-			// probably boring (normal task movement), so not
-			// worth logging I imagine.
+			g.peerFailed(peer, key, err)
 		}
-		value, err = g.getLocally(ctx, key, dest)
+		value, err = g.loadLocally(ctx, key, dest)
 		if err != nil {
-			g.Stats.LocalLoadErrs.Add(1)
 			return nil, err
 		}
-		g.Stats.LocalLoads.Add(1)
 		destPopulated = true // only one caller of load gets this return value
-		g.populateCache(key, value, &g.mainCache)
 		return value, nil
 	})
+	if !leader {
+		g.trace(ctx, TraceInfo{Event: TraceSingleflightJoin, Key: key, Duration: time.Since(start), Err: err})
+	}
 	if err == nil {
 		value = viewi.(ByteView)
 	}
 	return
 }
 
+// loadLocally loads key with the group's Getter into dest, and
+// caches the result in mainCache.
+func (g *Group) loadLocally(ctx Context, key string, dest Sink) (ByteView, error) {
+	start := time.Now()
+	value, err := g.getLocally(ctx, key, dest)
+	d := time.Since(start)
+	g.localLatency.observe(d)
+	g.trace(ctx, TraceInfo{Event: TraceLocalLoad, Key: key, Bytes: value.Len(), Duration: d, Err: err})
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
+		if ttl := g.opts.NegativeCacheTTL; ttl > 0 && negativelyCacheable(ctx, err) {
+			le := newLoadError(err, timeNow().Add(ttl))
+			g.populateCache(key, cacheEntry{err: le, expire: le.expire}, &g.mainCache)
+			return ByteView{}, le
+		}
+		return ByteView{}, err
+	}
+	g.Stats.LocalLoads.Add(1)
+	g.populateCache(key, g.newEntry(value), &g.mainCache)
+	return value, nil
+}
+
+// withoutPeer returns peers less skip, leaving peers as it is.
+func withoutPeer(peers []ProtoGetter, skip ProtoGetter) []ProtoGetter {
+	var rest []ProtoGetter
+	for _, peer := range peers {
+		if peer != skip {
+			rest = append(rest, peer)
+		}
+	}
+	return rest
+}
+
+// negativelyCacheable reports whether err, a failed load under ctx,
+// may be negatively cached. A load cut short by its Context being
+// canceled or past its deadline says nothing of the key, and caching
+// it would fail other callers' Gets.
+func negativelyCacheable(ctx Context, err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !abandoned(ctx)
+}
+
+// pickPeers returns the peers to try loading key from, in order of
+// preference. It is empty if key should be loaded locally.
+func (g *Group) pickPeers(key string) []ProtoGetter {
+	if mp, ok := g.peers.(MultiPeerPicker); ok && g.opts.PeerFallbacks > 0 {
+		return mp.PickN(key, 1+g.opts.PeerFallbacks)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []ProtoGetter{peer}
+	}
+	return nil
+}
+
+// ejected reports whether peer is to be skipped for having failed.
+func (g *Group) ejected(peer ProtoGetter) bool {
+	if g.opts.PeerEjectAfter <= 0 {
+		return false
+	}
+	g.ejectMu.Lock()
+	defer g.ejectMu.Unlock()
+	e := g.ejects[peer]
+	return e != nil && timeNow().Before(e.until)
+}
+
+// An ejection tracks the recent failures of a peer.
+type ejection struct {
+	failures int       // consecutive errors
+	until    time.Time // when the peer may be tried again
+}
+
+// peerFailed records err, returned by peer for key, ejecting the peer
+// once it has failed PeerEjectAfter times in a row.
+func (g *Group) peerFailed(peer ProtoGetter, key string, err error) {
+	g.recordPeerError(peer, key, err)
+	g.logger().log(LogWarn, "peer fetch failed", LogField{"group", g.name}, LogField{"key", key}, LogField{"peer", peerName(peer)}, LogField{"error", err})
+	if g.opts.PeerEjectAfter <= 0 {
+		return
+	}
+	g.ejectMu.Lock()
+	defer g.ejectMu.Unlock()
+	if g.ejects == nil {
+		g.ejects = make(map[ProtoGetter]*ejection)
+	}
+	e := g.ejects[peer]
+	if e == nil {
+		e = new(ejection)
+		g.ejects[peer] = e
+	}
+	e.failures++
+	if e.failures >= g.opts.PeerEjectAfter {
+		d := g.opts.PeerEjectFor
+		if d <= 0 {
+			d = defaultPeerEjectFor
+		}
+		e.failures = 0
+		e.until = timeNow().Add(d)
+		g.Stats.PeerEjections.Add(1)
+	}
+}
+
+// peerSucceeded records that peer answered, which resets its count of
+// consecutive errors.
+func (g *Group) peerSucceeded(peer ProtoGetter) {
+	if g.opts.PeerEjectAfter <= 0 {
+		return
+	}
+	g.ejectMu.Lock()
+	defer g.ejectMu.Unlock()
+	delete(g.ejects, peer)
+}
+
+// forgetPeers drops what g knows of peers other than live, such as
+// their ejections, which would otherwise keep replaced getters
+// reachable.
+func (g *Group) forgetPeers(live []ProtoGetter) {
+	keep := make(map[ProtoGetter]bool, len(live))
+	for _, peer := range live {
+		keep[peer] = true
+	}
+	g.ejectMu.Lock()
+	for peer := range g.ejects {
+		if !keep[peer] {
+			delete(g.ejects, peer)
+		}
+	}
+	g.ejectMu.Unlock()
+	g.latencyMu.Lock()
+	for peer := range g.latencies {
+		if !keep[peer] {
+			delete(g.latencies, peer)
+		}
+	}
+	g.latencyMu.Unlock()
+	g.forgetPeerErrors(live)
+}
+
+// refresh reloads key in the background to replace its stale cache
+// entry, unless a refresh of key is already running. The reload
+// outlives the Get that found the entry stale: it runs with the
+// values of ctx but not its deadline or cancellation, and is traced
+// as a Get of its own.
+func (g *Group) refresh(ctx Context, key string) {
+	cancel := func() {}
+	if c, ok := ctx.(context.Context); ok {
+		ctx, cancel = context.WithCancel(detachedContext{c})
+	}
+	g.refreshMu.Lock()
+	if g.refreshStopped || g.refreshing[key] != nil {
+		g.refreshMu.Unlock()
+		cancel()
+		return
+	}
+	if g.refreshing == nil {
+		g.refreshing = make(map[string]context.CancelFunc)
+	}
+	g.refreshing[key] = cancel
+	g.refreshMu.Unlock()
+
+	g.Stats.Refreshes.Add(1)
+	go func() {
+		defer func() {
+			g.refreshMu.Lock()
+			delete(g.refreshing, key)
+			g.refreshMu.Unlock()
+			cancel()
+		}()
+		ctx, traceEnd := g.traceStart(ctx, key)
+		var value ByteView
+		_, _, err := g.load(ctx, key, ByteViewSink(&value), nil)
+		traceEnd(err)
+	}()
+}
+
+// stopRefreshes cancels the group's running refreshes, and keeps new
+// ones from starting.
+func (g *Group) stopRefreshes() {
+	g.refreshMu.Lock()
+	defer g.refreshMu.Unlock()
+	g.refreshStopped = true
+	for _, cancel := range g.refreshing {
+		cancel()
+	}
+}
+
+// A detachedContext carries the values of its parent, but none of its
+// deadline or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// newEntry returns a cache entry for value, loaded just now.
+func (g *Group) newEntry(value ByteView) cacheEntry {
+	e := cacheEntry{value: value}
+	now := timeNow()
+	if g.opts.SoftTTL > 0 {
+		e.staleAt = now.Add(g.opts.SoftTTL)
+	}
+	if g.opts.HardTTL > 0 {
+		e.expire = now.Add(g.opts.HardTTL)
+	}
+	return e
+}
+
 func (g *Group) getLocally(ctx Context, key string, dest Sink) (ByteView, error) {
 	err := g.getter.Get(ctx, key, dest)
 	if err != nil {
@@ -346,21 +830,83 @@ func (g *Group) getFromPeer(ctx Context, peer ProtoGetter, key string) (ByteView
 		Key:   &key,
 	}
 	res := &pb.GetResponse{}
-	log.Println("context=====333", ctx)
+	start := time.Now()
 	err := peer.Get(ctx, req, res)
+	d := time.Since(start)
+	g.peerLatency.observe(d)
+	if err == nil && res.Error != nil {
+		err = g.peerLoadError(key, res)
+	}
+	g.trace(ctx, TraceInfo{Event: TracePeerFetch, Key: key, Peer: peerName(peer), Bytes: len(res.Value), Duration: d, Err: err})
 	if err != nil {
 		return ByteView{}, err
 	}
 	value := ByteView{b: res.Value}
 	// TODO(bradfitz): use res.MinuteQps or something smart to
 	// conditionally populate hotCache.  For now just do it some
-	// percentage of the time.
-	if rand.Intn(10) == 0 {
-		g.populateCache(key, value, &g.hotCache)
+	// percentage of the time. A key already in the hotCache is
+	// being refreshed, so always replace it.
+	if rand.Intn(10) == 0 || g.hotCache.contains(key) {
+		g.populateCache(key, g.newEntry(value), &g.hotCache)
 	}
 	return value, nil
 }
 
+// peerLoadError returns the failed load of key that a peer reported
+// in res.
+func (g *Group) peerLoadError(key string, res *pb.GetResponse) *loadError {
+	code := res.GetErrorCode()
+	if code == pb.ErrorCode_ERR_UNKNOWN {
+		// Peers predating error codes only tell keys not found.
+		code = pb.ErrorCode_ERR_BACKEND
+		if res.GetNotFound() {
+			code = pb.ErrorCode_ERR_NOT_FOUND
+		}
+	}
+	le := &loadError{
+		err:    errors.New(res.GetError()),
+		code:   code,
+		expire: timeNow().Add(time.Duration(res.GetTtlMs()) * time.Millisecond),
+	}
+	// Negative entries are small and short-lived, so always
+	// mirror them rather than re-asking the owner each time.
+	if g.opts.NegativeCacheTTL > 0 && res.GetTtlMs() > 0 {
+		g.populateCache(key, cacheEntry{err: le, expire: le.expire}, &g.hotCache)
+	}
+	return le
+}
+
+// servePeer answers a peer's request for key, first saving value
+// under it if non-empty. A failed load is reported in the response,
+// classified by its code, so that the peer can tell it from a failure
+// to reach us and does not retry the load itself. A failure that is
+// negatively cached carries a TTL, so that the peer does not re-ask
+// us before it expires.
+func (g *Group) servePeer(ctx Context, key string, value []byte) *pb.GetResponse {
+	g.Stats.ServerRequests.Add(1)
+	dest := AllocatingByteSliceSink(&value)
+	dest.SetBytes(value)
+
+	res := &pb.GetResponse{}
+	err := g.Get(ctx, key, dest)
+	if err == nil {
+		res.Value = value
+		return res
+	}
+	code := errorCode(err)
+	res.Error = proto.String(err.Error())
+	res.ErrorCode = code.Enum()
+	res.NotFound = proto.Bool(code == pb.ErrorCode_ERR_NOT_FOUND)
+	if le, ok := err.(*loadError); ok && le.expire.After(timeNow()) {
+		ttl := int64(le.expire.Sub(timeNow()) / time.Millisecond)
+		if ttl < 1 {
+			ttl = 1
+		}
+		res.TtlMs = proto.Int64(ttl)
+	}
+	return res
+}
+
 ///////////////////overnest
 func (g *Group) saveToPeer(ctx Context, peer ProtoGetter, key string, value []byte) {
 	req := &pb.GetRequest{
@@ -368,50 +914,88 @@ func (g *Group) saveToPeer(ctx Context, peer ProtoGetter, key string, value []by
 		Key:   &key,
 		Value: value,
 	}
-	log.Println("saveToPeer.......")
-	log.Println(value)
+	if l := g.logger(); l.enabled(LogDebug) {
+		l.log(LogDebug, "saving to peer", LogField{"group", g.name}, LogField{"key", key}, LogField{"peer", peerName(peer)}, l.value(value))
+	}
 	res := &pb.GetResponse{}
-	peer.Get(ctx, req, res)
+	if err := peer.Get(ctx, req, res); err != nil {
+		g.logger().log(LogWarn, "saving to peer failed", LogField{"group", g.name}, LogField{"key", key}, LogField{"peer", peerName(peer)}, LogField{"error", err})
+	}
 	return
 }
 
 ////////////////////////////
 
-func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
-	if g.cacheBytes <= 0 {
+// CacheBytes returns the limit on the combined size of the group's
+// caches.
+func (g *Group) CacheBytes() int64 {
+	return atomic.LoadInt64(&g.cacheBytes)
+}
+
+// SetCacheBytes changes the limit on the combined size of the group's
+// caches, evicting entries immediately if they no longer fit. A limit
+// of zero or less disables caching.
+func (g *Group) SetCacheBytes(n int64) {
+	atomic.StoreInt64(&g.cacheBytes, n)
+	if n <= 0 {
+		g.Clear()
 		return
 	}
-	value, ok = g.mainCache.get(key)
-	if ok {
+	g.evict()
+}
+
+// Clear removes all entries from the group's caches. Loads already in
+// progress may still populate them. Clear does not reset Stats.
+func (g *Group) Clear() {
+	g.mainCache.clear()
+	g.hotCache.clear()
+}
+
+func (g *Group) lookupCache(key string) (e cacheEntry, ok bool) {
+	if g.CacheBytes() <= 0 {
 		return
 	}
-	value, ok = g.hotCache.get(key)
+	e, ok = g.mainCache.get(key)
+	if !ok {
+		e, ok = g.hotCache.get(key)
+	}
+	if ok {
+		g.util.hit()
+	}
 	return
 }
 
-func (g *Group) populateCache(key string, value ByteView, cache *cache) {
-	if g.cacheBytes <= 0 {
+func (g *Group) populateCache(key string, e cacheEntry, cache *cache) {
+	if g.CacheBytes() <= 0 {
 		return
 	}
-	cache.add(key, value)
+	cache.add(key, e)
+	g.evict()
+	budgetCached(int64(len(key)) + e.size())
+}
 
-	// Evict items from cache(s) if necessary.
-	for {
-		mainBytes := g.mainCache.bytes()
-		hotBytes := g.hotCache.bytes()
-		if mainBytes+hotBytes <= g.cacheBytes {
-			return
-		}
+// evict removes items from the caches until they fit in cacheBytes.
+func (g *Group) evict() {
+	for g.cachedBytes() > g.CacheBytes() {
+		g.removeOldest()
+	}
+}
 
-		// TODO(bradfitz): this is good-enough-for-now logic.
-		// It should be something based on measurements and/or
-		// respecting the costs of different resources.
-		victim := &g.mainCache
-		if hotBytes > mainBytes/8 {
-			victim = &g.hotCache
-		}
-		victim.removeOldest()
+// cachedBytes returns the combined size of the group's caches.
+func (g *Group) cachedBytes() int64 {
+	return g.mainCache.bytes() + g.hotCache.bytes()
+}
+
+// removeOldest evicts the oldest item of one of the group's caches.
+func (g *Group) removeOldest() {
+	// TODO(bradfitz): this is good-enough-for-now logic.
+	// It should be something based on measurements and/or
+	// respecting the costs of different resources.
+	victim := &g.mainCache
+	if g.hotCache.bytes() > g.mainCache.bytes()/8 {
+		victim = &g.hotCache
 	}
+	victim.removeOldest()
 }
 
 // CacheType represents a type of cache.
@@ -440,15 +1024,98 @@ func (g *Group) CacheStats(which CacheType) CacheStats {
 	}
 }
 
+// timeNow returns the current time. Tests may replace it to control
+// cache expiry.
+var timeNow = time.Now
+
+// A loadError is a failed load of a key that has been negatively
+// cached, either by this process or by the peer that owns the key.
+type loadError struct {
+	err    error        // the Getter's error, or a peer's report of it
+	code   pb.ErrorCode // classifies err
+	expire time.Time
+}
+
+func newLoadError(err error, expire time.Time) *loadError {
+	return &loadError{
+		err:    err,
+		code:   errorCode(err),
+		expire: expire,
+	}
+}
+
+func (e *loadError) Error() string { return e.err.Error() }
+
+func (e *loadError) Unwrap() error { return e.err }
+
+// Is reports whether e matches the error of its code, such as
+// ErrNotFound, which holds even when the original error did not
+// survive the trip from a peer.
+func (e *loadError) Is(target error) bool {
+	return isCode(e.code, target)
+}
+
+// A cacheEntry is what a cache holds for a key: either a value or,
+// for a negative entry, the error its load failed with.
+type cacheEntry struct {
+	value   ByteView
+	err     *loadError
+	staleAt time.Time // zero means the entry never goes stale
+	expire  time.Time // zero means the entry never expires
+
+	// codec, if non-nil, is what value is compressed with, from
+	// rawLen bytes. Only a cache holds compressed entries.
+	codec  *codec
+	rawLen int
+}
+
+// A keyedEntry is a cacheEntry together with its key.
+type keyedEntry struct {
+	key string
+	cacheEntry
+}
+
+// size returns the number of bytes e is accounted as, excluding its key.
+func (e cacheEntry) size() int64 {
+	if e.err != nil {
+		return int64(len(e.err.Error()))
+	}
+	return int64(e.value.Len())
+}
+
+// saved returns the number of bytes compressing e saved.
+func (e cacheEntry) saved() int64 {
+	if e.codec == nil {
+		return 0
+	}
+	return int64(e.rawLen - e.value.Len())
+}
+
+// stale reports whether e should be refreshed as of now.
+func (e cacheEntry) stale(now time.Time) bool {
+	return !e.staleAt.IsZero() && !now.Before(e.staleAt)
+}
+
+// expired reports whether e has expired as of now.
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
 // cache is a wrapper around an *lru.Cache that adds synchronization,
-// makes values always be ByteView, and counts the size of all keys and
-// values.
+// makes values always be cacheEntry, and counts the size of all keys
+// and values.
 type cache struct {
 	mu         sync.RWMutex
 	nbytes     int64 // of all keys and values
 	lru        *lru.Cache
 	nhit, nget int64
 	nevict     int64 // number of evictions
+	nsaved     int64 // bytes saved by compression
+
+	// codec, if non-nil, compresses values of at least minBytes.
+	// It is set before the cache is used.
+	codec    *codec
+	minBytes int
 }
 
 func (c *cache) stats() CacheStats {
@@ -460,38 +1127,143 @@ func (c *cache) stats() CacheStats {
 		Gets:      c.nget,
 		Hits:      c.nhit,
 		Evictions: c.nevict,
+		Saved:     c.nsaved,
 	}
 }
 
-func (c *cache) add(key string, value ByteView) {
+func (c *cache) add(key string, e cacheEntry) {
+	e = c.pack(e)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
 		c.lru = &lru.Cache{
 			OnEvicted: func(key lru.Key, value interface{}) {
-				val := value.(ByteView)
-				c.nbytes -= int64(len(key.(string))) + int64(val.Len())
+				val := value.(cacheEntry)
+				c.nbytes -= int64(len(key.(string))) + val.size()
+				c.nsaved -= val.saved()
 				c.nevict++
 			},
 		}
 	}
-	c.lru.Add(key, value)
-	c.nbytes += int64(len(key)) + int64(value.Len())
+	// Replacing an entry in place would leave its old size counted.
+	c.lru.Remove(key)
+	c.lru.Add(key, e)
+	c.nbytes += int64(len(key)) + e.size()
+	c.nsaved += e.saved()
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
+// get returns the entry for key. Expired entries, and those that
+// fail to decompress, are removed and reported as misses.
+func (c *cache) get(key string) (e cacheEntry, ok bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	c.nget++
 	if c.lru == nil {
+		c.mu.Unlock()
 		return
 	}
 	vi, ok := c.lru.Get(key)
 	if !ok {
+		c.mu.Unlock()
 		return
 	}
+	e = vi.(cacheEntry)
+	if e.expired(timeNow()) {
+		c.lru.Remove(key)
+		c.mu.Unlock()
+		return cacheEntry{}, false
+	}
 	c.nhit++
-	return vi.(ByteView), true
+	c.mu.Unlock()
+
+	e, err := unpack(e)
+	if err != nil {
+		c.remove(key)
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// pack returns e with its value compressed, if the cache compresses
+// values and that saves space.
+func (c *cache) pack(e cacheEntry) cacheEntry {
+	if c.codec == nil || e.err != nil || e.codec != nil {
+		return e
+	}
+	raw := e.value.b
+	if raw == nil {
+		raw = []byte(e.value.s)
+	}
+	if b, ok := c.codec.compress(raw, c.minBytes); ok {
+		e.rawLen = len(raw)
+		e.value = ByteView{b: b}
+		e.codec = c.codec
+	}
+	return e
+}
+
+// unpack returns e with its value decompressed.
+func unpack(e cacheEntry) (cacheEntry, error) {
+	if e.codec == nil {
+		return e, nil
+	}
+	b, err := e.codec.decode(e.value.b, 0)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	e.value = ByteView{b: b}
+	e.codec, e.rawLen = nil, 0
+	return e, nil
+}
+
+// entries returns the cache's entries, from the least to the most
+// recently used.
+func (c *cache) entries() []keyedEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return nil
+	}
+	kes := make([]keyedEntry, 0, c.lru.Len())
+	c.lru.Range(func(key lru.Key, value interface{}) bool {
+		kes = append(kes, keyedEntry{key.(string), value.(cacheEntry)})
+		return true
+	})
+	unpacked := kes[:0]
+	for _, ke := range kes {
+		if e, err := unpack(ke.cacheEntry); err == nil {
+			unpacked = append(unpacked, keyedEntry{ke.key, e})
+		}
+	}
+	return unpacked
+}
+
+// contains reports whether key is in the cache, without counting as
+// a get or updating its recent use.
+func (c *cache) contains(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lru == nil {
+		return false
+	}
+	return c.lru.Contains(key)
+}
+
+// remove removes the entry for key, if any.
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Remove(key)
+	}
+}
+
+// clear removes all entries. They are not counted as evictions.
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru = nil
+	c.nbytes = 0
+	c.nsaved = 0
 }
 
 func (c *cache) removeOldest() {
@@ -545,4 +1317,5 @@ type CacheStats struct {
 	Gets      int64
 	Hits      int64
 	Evictions int64
+	Saved     int64 // bytes saved by compressing values held now
 }
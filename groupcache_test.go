@@ -19,17 +19,17 @@ limitations under the License.
 package groupcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"math/rand"
-	"reflect"
 	"sync"
 	"testing"
 	"time"
 	"unsafe"
 
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
 
 	pb "github.com/golang/groupcache/groupcachepb"
 	testpb "github.com/golang/groupcache/testpb"
@@ -120,6 +120,37 @@ func TestGetDupSuppressString(t *testing.T) {
 	}
 }
 
+// v1Message is a message as generated by the older
+// github.com/golang/protobuf, which implements only its API.
+type v1Message struct {
+	Name *string `protobuf:"bytes,1,opt,name=name"`
+	City *string `protobuf:"bytes,2,opt,name=city"`
+}
+
+func (m *v1Message) Reset()         { *m = v1Message{} }
+func (m *v1Message) String() string { return fmt.Sprintf("%+v", *m) }
+func (*v1Message) ProtoMessage()    {}
+
+func TestProtoSinkV1(t *testing.T) {
+	var b []byte
+	if err := AllocatingByteSliceSink(&b).SetProto(&v1Message{Name: proto.String("name"), City: proto.String("city")}); err != nil {
+		t.Fatal(err)
+	}
+	// The wire format is that of the equivalent generated message.
+	var tm testpb.TestMessage
+	if err := proto.Unmarshal(b, &tm); err != nil || tm.GetName() != "name" || tm.GetCity() != "city" {
+		t.Errorf("decoded %v, %v; want name and city", &tm, err)
+	}
+
+	var m v1Message
+	if err := ProtoSink(&m).SetBytes(b); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name == nil || *m.Name != "name" || m.City == nil || *m.City != "city" {
+		t.Errorf("ProtoSink set %+v; want name and city", m)
+	}
+}
+
 // tests that a Getter's Get method is only called once with two
 // outstanding callers.  This is the proto variant.
 func TestGetDupSuppressProto(t *testing.T) {
@@ -155,8 +186,8 @@ func TestGetDupSuppressProto(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		select {
 		case v := <-resc:
-			if !reflect.DeepEqual(v, want) {
-				t.Errorf(" Got: %v\nWant: %v", proto.CompactTextString(v), proto.CompactTextString(want))
+			if !proto.Equal(v, want) {
+				t.Errorf(" Got: %v\nWant: %v", v, want)
 			}
 		case <-time.After(5 * time.Second):
 			t.Errorf("timeout waiting on getter #%d of 2", i+1)
@@ -263,7 +294,7 @@ func TestPeers(t *testing.T) {
 		localHits++
 		return dest.SetString("got:" + key)
 	}
-	testGroup := newGroup("TestPeers-group", cacheSize, GetterFunc(getter), peerList)
+	testGroup := NewGroupOpts("TestPeers-group", cacheSize, GetterFunc(getter), &GroupOptions{Peers: peerList})
 	run := func(name string, n int, wantSummary string) {
 		// Reset counters
 		localHits = 0
@@ -349,7 +380,7 @@ func TestAllocatingByteSliceTarget(t *testing.T) {
 	if want := "some bytes"; string(dst) != want {
 		t.Errorf("SetBytes resulted in %q; want %q", dst, want)
 	}
-	v, err := sink.view()
+	v, err := sink.View()
 	if err != nil {
 		t.Fatalf("view after SetBytes failed: %v", err)
 	}
@@ -387,9 +418,9 @@ func (g *orderedFlightGroup) Do(key string, fn func() (interface{}, error)) (int
 func TestNoDedup(t *testing.T) {
 	const testkey = "testkey"
 	const testval = "testval"
-	g := newGroup("testgroup", 1024, GetterFunc(func(_ Context, key string, dest Sink) error {
+	g := NewGroup("testgroup", 1024, GetterFunc(func(_ Context, key string, dest Sink) error {
 		return dest.SetString(testval)
-	}), nil)
+	}))
 
 	orderedGroup := &orderedFlightGroup{
 		stage1: make(chan bool),
@@ -444,6 +475,400 @@ func TestNoDedup(t *testing.T) {
 	}
 }
 
+// setTimeNow makes timeNow return *now until the returned func is called.
+func setTimeNow(now *time.Time) (restore func()) {
+	timeNow = func() time.Time { return *now }
+	return func() { timeNow = time.Now }
+}
+
+func TestNegativeCaching(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	var loads int
+	g := NewGroupOpts("TestNegativeCaching-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		loads++
+		return fmt.Errorf("loading %q: %w", key, ErrNotFound)
+	}), &GroupOptions{Peers: NoPeers{}, NegativeCacheTTL: time.Second})
+
+	for i := 0; i < 3; i++ {
+		var s string
+		err := g.Get(dummyCtx, "absent", StringSink(&s))
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get #%d = %v; want ErrNotFound", i, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d; want 1", loads)
+	}
+	if got := g.Stats.NegativeHits.Get(); got != 2 {
+		t.Errorf("NegativeHits = %d; want 2", got)
+	}
+
+	now = now.Add(time.Second)
+	var s string
+	g.Get(dummyCtx, "absent", StringSink(&s))
+	if loads != 2 {
+		t.Errorf("after expiry, loads = %d; want 2", loads)
+	}
+}
+
+func TestNegativeCachingCanceled(t *testing.T) {
+	g := NewGroupOpts("TestNegativeCachingCanceled-group", cacheSize, GetterFunc(func(ctx Context, key string, dest Sink) error {
+		if err := ctx.(context.Context).Err(); err != nil {
+			if key == "wrapped" {
+				return fmt.Errorf("loading %q: %w", key, err)
+			}
+			return errors.New("backend gave up")
+		}
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: NoPeers{}, NegativeCacheTTL: time.Minute})
+	defer DeregisterGroup(g.Name())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, key := range []string{"wrapped", "abandoned"} {
+		var s string
+		if err := g.Get(canceled, key, StringSink(&s)); err == nil {
+			t.Fatalf("Get(%q) with a canceled Context succeeded", key)
+		}
+		if err := g.Get(context.Background(), key, StringSink(&s)); err != nil || s != "value" {
+			t.Errorf("Get(%q) after a canceled load = %q, %v; want %q", key, s, err, "value")
+		}
+	}
+}
+
+type negativePeer struct {
+	hits int
+}
+
+func (p *negativePeer) Get(_ Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	p.hits++
+	out.Error = proto.String("no such key " + in.GetKey())
+	out.NotFound = proto.Bool(true)
+	out.TtlMs = proto.Int64(500)
+	return nil
+}
+
+// tests that a negative response from the owner is returned to the
+// caller and mirrored, rather than triggering a local load.
+func TestNegativeCachingFromPeer(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	peer := &negativePeer{}
+	var loads int
+	g := NewGroupOpts("TestNegativeCachingFromPeer-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{Peers: fakePeers{peer}, NegativeCacheTTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		var s string
+		if err := g.Get(dummyCtx, "absent", StringSink(&s)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get #%d = %v; want ErrNotFound", i, err)
+		}
+	}
+	if loads != 0 || peer.hits != 1 {
+		t.Errorf("loads = %d, peer hits = %d; want 0, 1", loads, peer.hits)
+	}
+
+	// The owner's TTL, not ours, bounds the mirrored entry.
+	now = now.Add(500 * time.Millisecond)
+	var s string
+	g.Get(dummyCtx, "absent", StringSink(&s))
+	if peer.hits != 2 {
+		t.Errorf("after expiry, peer hits = %d; want 2", peer.hits)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	var loads AtomicInt
+	g := NewGroupOpts("TestStaleWhileRevalidate-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		loads.Add(1)
+		return dest.SetString(fmt.Sprintf("%s-v%d", key, loads.Get()))
+	}), &GroupOptions{Peers: NoPeers{}, SoftTTL: time.Second, HardTTL: time.Minute})
+
+	get := func() string {
+		var s string
+		if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	// waitLoads waits for n loads and for background refreshes to
+	// have finished populating the cache.
+	waitLoads := func(n int64) {
+		deadline := time.After(5 * time.Second)
+		for {
+			g.refreshMu.Lock()
+			idle := len(g.refreshing) == 0
+			g.refreshMu.Unlock()
+			if idle && loads.Get() >= n {
+				return
+			}
+			select {
+			case <-deadline:
+				t.Fatalf("timeout waiting for %d loads; have %d", n, loads.Get())
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	if got, want := get(), "k-v1"; got != want {
+		t.Fatalf("first Get = %q; want %q", got, want)
+	}
+
+	// Past the soft TTL the old value is still served, while it is
+	// reloaded in the background.
+	now = now.Add(time.Second)
+	if got, want := get(), "k-v1"; got != want {
+		t.Errorf("stale Get = %q; want %q", got, want)
+	}
+	waitLoads(2)
+	if got, want := get(), "k-v2"; got != want {
+		t.Errorf("Get after refresh = %q; want %q", got, want)
+	}
+	if got := g.Stats.StaleHits.Get(); got != 1 {
+		t.Errorf("StaleHits = %d; want 1", got)
+	}
+
+	// Past the hard TTL the Get blocks on the reload.
+	now = now.Add(time.Minute)
+	if got, want := get(), "k-v3"; got != want {
+		t.Errorf("expired Get = %q; want %q", got, want)
+	}
+}
+
+type refreshKey struct{}
+
+func TestRefreshOutlivesGet(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	type load struct {
+		ctx  context.Context
+		done chan error // gets what the Getter then returns
+	}
+	loads := make(chan load)
+	g := NewGroupOpts("TestRefreshOutlivesGet-group", cacheSize, GetterFunc(func(ctx Context, key string, dest Sink) error {
+		l := load{ctx.(context.Context), make(chan error)}
+		loads <- l
+		if err := <-l.done; err != nil {
+			return err
+		}
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: NoPeers{}, SoftTTL: time.Second, HardTTL: time.Minute})
+	defer DeregisterGroup(g.Name())
+
+	get := func(ctx context.Context) {
+		var s string
+		if err := g.Get(ctx, "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go func() {
+		l := <-loads
+		l.done <- nil
+	}()
+	get(context.Background())
+
+	// The refresh started by a stale Get goes on once the Get's
+	// Context is canceled, with its values.
+	now = now.Add(time.Second)
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), refreshKey{}, "v"), time.Minute)
+	get(ctx)
+	cancel()
+	l := <-loads
+	if _, ok := l.ctx.Deadline(); ok || l.ctx.Err() != nil || l.ctx.Value(refreshKey{}) != "v" {
+		t.Errorf("refresh Context: deadline %v, error %v, value %v; want none, none and %q", ok, l.ctx.Err(), l.ctx.Value(refreshKey{}), "v")
+	}
+
+	// Deregistering the group cancels it.
+	DeregisterGroup(g.Name())
+	select {
+	case <-l.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("refresh still running after DeregisterGroup")
+	}
+	l.done <- l.ctx.Err()
+}
+
+func TestDeregisterGroup(t *testing.T) {
+	const name = "TestDeregisterGroup-group"
+	getter := GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	})
+	g := NewGroup(name, cacheSize, getter)
+	if !DeregisterGroup(name) {
+		t.Fatal("DeregisterGroup of a registered group = false")
+	}
+	if GetGroup(name) != nil {
+		t.Fatal("GetGroup found a deregistered group")
+	}
+	if DeregisterGroup(name) {
+		t.Error("second DeregisterGroup = true")
+	}
+	if g2 := NewGroup(name, cacheSize, getter); g2 == g || GetGroup(name) != g2 {
+		t.Error("re-created group is not the registered one")
+	}
+}
+
+func TestClearAndSetCacheBytes(t *testing.T) {
+	var loads AtomicInt
+	g := NewGroupOpts("TestClearAndSetCacheBytes-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		loads.Add(1)
+		return dest.SetString("value-of-" + key)
+	}), &GroupOptions{Peers: NoPeers{}})
+
+	// Hammer the group concurrently so the race detector can see
+	// reconfiguration racing with Gets.
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			var s string
+			g.Get(dummyCtx, fmt.Sprintf("bg-%d", i%50), StringSink(&s))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		var s string
+		if err := g.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		switch i % 10 {
+		case 3:
+			g.SetCacheBytes(cacheSize / 2)
+		case 6:
+			g.Clear()
+		case 9:
+			g.SetCacheBytes(cacheSize)
+		}
+	}
+	<-done
+
+	const limit = 256
+	g.SetCacheBytes(limit)
+	if got := g.CacheBytes(); got != limit {
+		t.Errorf("CacheBytes = %d; want %d", got, limit)
+	}
+	if got := g.mainCache.bytes() + g.hotCache.bytes(); got > limit {
+		t.Errorf("after SetCacheBytes(%d), caches hold %d bytes", limit, got)
+	}
+
+	g.Clear()
+	if items := g.mainCache.items() + g.hotCache.items(); items != 0 {
+		t.Errorf("after Clear, caches hold %d items", items)
+	}
+	loads0 := loads.Get()
+	var s string
+	g.Get(dummyCtx, "key-99", StringSink(&s))
+	if loads.Get() != loads0+1 {
+		t.Error("Get after Clear did not reload")
+	}
+}
+
+// rankedPeers is a MultiPeerPicker that prefers its peers in order
+// for every key.
+type rankedPeers []ProtoGetter
+
+func (p rankedPeers) PickPeer(key string) (ProtoGetter, bool) {
+	return p[0], true
+}
+
+func (p rankedPeers) PickN(key string, n int) []ProtoGetter {
+	if n > len(p) {
+		n = len(p)
+	}
+	return p[:n]
+}
+
+func TestPeerFallbacks(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	primary := &fakePeer{fail: true}
+	secondary := &fakePeer{}
+	var localLoads int
+	g := NewGroupOpts("TestPeerFallbacks-group", 0, GetterFunc(func(_ Context, key string, dest Sink) error {
+		localLoads++
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{
+		Peers:          rankedPeers{primary, secondary},
+		PeerFallbacks:  1,
+		PeerEjectAfter: 2,
+		PeerEjectFor:   time.Minute,
+	})
+
+	get := func(key string) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if want := "got:" + key; s != want {
+			t.Errorf("Get(%q) = %q; want %q from the secondary owner", key, s, want)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		get(fmt.Sprintf("key-%d", i))
+	}
+	if localLoads != 0 {
+		t.Errorf("localLoads = %d; want 0", localLoads)
+	}
+	// Two failures eject the primary, which is then skipped.
+	if primary.hits != 2 || secondary.hits != 4 {
+		t.Errorf("hits = %d, %d; want 2, 4", primary.hits, secondary.hits)
+	}
+	if got := g.Stats.PeerEjections.Get(); got != 1 {
+		t.Errorf("PeerEjections = %d; want 1", got)
+	}
+	if got := g.Stats.PeerFallbacks.Get(); got != 4 {
+		t.Errorf("PeerFallbacks = %d; want 4", got)
+	}
+
+	// After the cool-down the primary is tried again, and serves
+	// once it has recovered.
+	now = now.Add(time.Minute)
+	primary.fail = false
+	get("key-4")
+	if primary.hits != 3 || secondary.hits != 4 {
+		t.Errorf("after cool-down, hits = %d, %d; want 3, 4", primary.hits, secondary.hits)
+	}
+}
+
+func TestForgetReplacedPeers(t *testing.T) {
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	g := NewGroupOpts("TestForgetReplacedPeers-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), &GroupOptions{Peers: p, PeerEjectAfter: 1, HedgeAtP95: true})
+	defer DeregisterGroup(g.Name())
+
+	p.Set("http://self", "http://a", "http://b")
+	a, b := p.httpGetters["http://a"], p.httpGetters["http://b"]
+	g.peerFailed(a, "k", errors.New("failed"))
+	g.peerFailed(b, "k", errors.New("failed"))
+	g.recordLatency(a, time.Millisecond)
+
+	p.Set("http://self", "http://b")
+	b = p.httpGetters["http://b"]
+	g.peerFailed(b, "k", errors.New("failed"))
+	g.ejectMu.Lock()
+	n := len(g.ejects)
+	g.ejectMu.Unlock()
+	if n != 1 || !g.ejected(b) {
+		t.Errorf("%d ejections after Set, b ejected: %v; want only the current b", n, g.ejected(b))
+	}
+	g.latencyMu.Lock()
+	n = len(g.latencies)
+	g.latencyMu.Unlock()
+	if n != 0 {
+		t.Errorf("latencies of %d peers kept after Set; want none", n)
+	}
+}
+
 func TestGroupStatsAlignment(t *testing.T) {
 	var g Group
 	off := unsafe.Offsetof(g.Stats)
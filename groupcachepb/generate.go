@@ -0,0 +1,8 @@
+// Package groupcachepb holds the messages groupcache peers exchange.
+// groupcache.proto is their single source of truth: groupcache.pb.go
+// is generated from it with protoc-gen-go, and the GroupCache service
+// of groupcache_grpc.pb.go with protoc-gen-go-grpc. TestProtoMatchesGo
+// checks that they were regenerated when the .proto last changed.
+package groupcachepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative groupcache.proto
@@ -1,72 +1,477 @@
-// Code generated by protoc-gen-go.
+//
+//Copyright 2012 Google Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
 // source: groupcache.proto
-// DO NOT EDIT!
 
 package groupcachepb
 
-import proto "github.com/golang/protobuf/proto"
-import json "encoding/json"
-import math "math"
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ErrorCode classifies the error of a GetResponse, so that callers
+// can tell whether retrying might help.
+type ErrorCode int32
+
+const (
+	ErrorCode_ERR_UNKNOWN      ErrorCode = 0 // sent by peers predating error_code
+	ErrorCode_ERR_NOT_FOUND    ErrorCode = 1 // the key does not exist
+	ErrorCode_ERR_BACKEND      ErrorCode = 2 // the owner failed to load the key
+	ErrorCode_ERR_OVERLOADED   ErrorCode = 3 // the owner is too busy; retry later
+	ErrorCode_ERR_UNAUTHORIZED ErrorCode = 4 // the load was refused
+)
+
+// Enum value maps for ErrorCode.
+var (
+	ErrorCode_name = map[int32]string{
+		0: "ERR_UNKNOWN",
+		1: "ERR_NOT_FOUND",
+		2: "ERR_BACKEND",
+		3: "ERR_OVERLOADED",
+		4: "ERR_UNAUTHORIZED",
+	}
+	ErrorCode_value = map[string]int32{
+		"ERR_UNKNOWN":      0,
+		"ERR_NOT_FOUND":    1,
+		"ERR_BACKEND":      2,
+		"ERR_OVERLOADED":   3,
+		"ERR_UNAUTHORIZED": 4,
+	}
+)
+
+func (x ErrorCode) Enum() *ErrorCode {
+	p := new(ErrorCode)
+	*p = x
+	return p
+}
+
+func (x ErrorCode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
 
-// Reference proto, json, and math imports to suppress error if they are not otherwise used.
-var _ = proto.Marshal
-var _ = &json.SyntaxError{}
-var _ = math.Inf
+func (ErrorCode) Descriptor() protoreflect.EnumDescriptor {
+	return file_groupcache_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorCode) Type() protoreflect.EnumType {
+	return &file_groupcache_proto_enumTypes[0]
+}
+
+func (x ErrorCode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *ErrorCode) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = ErrorCode(num)
+	return nil
+}
+
+// Deprecated: Use ErrorCode.Descriptor instead.
+func (ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{0}
+}
+
+// Capability is a feature of the protocol that a peer may support,
+// as a bit of Hello.capabilities.
+type Capability int32
+
+const (
+	Capability_CAP_PUT         Capability = 1  // GetRequest.value saves the value
+	Capability_CAP_HANDOFF     Capability = 2  // values may be handed off to the peer
+	Capability_CAP_COMPRESSION Capability = 4  // responses may be compressed
+	Capability_CAP_STREAM      Capability = 8  // responses may be streamed
+	Capability_CAP_BATCH       Capability = 16 // reserved for batched gets
+)
+
+// Enum value maps for Capability.
+var (
+	Capability_name = map[int32]string{
+		1:  "CAP_PUT",
+		2:  "CAP_HANDOFF",
+		4:  "CAP_COMPRESSION",
+		8:  "CAP_STREAM",
+		16: "CAP_BATCH",
+	}
+	Capability_value = map[string]int32{
+		"CAP_PUT":         1,
+		"CAP_HANDOFF":     2,
+		"CAP_COMPRESSION": 4,
+		"CAP_STREAM":      8,
+		"CAP_BATCH":       16,
+	}
+)
+
+func (x Capability) Enum() *Capability {
+	p := new(Capability)
+	*p = x
+	return p
+}
+
+func (x Capability) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Capability) Descriptor() protoreflect.EnumDescriptor {
+	return file_groupcache_proto_enumTypes[1].Descriptor()
+}
+
+func (Capability) Type() protoreflect.EnumType {
+	return &file_groupcache_proto_enumTypes[1]
+}
+
+func (x Capability) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *Capability) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = Capability(num)
+	return nil
+}
+
+// Deprecated: Use Capability.Descriptor instead.
+func (Capability) EnumDescriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{1}
+}
 
 type GetRequest struct {
-	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
-	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
-	Value            []byte  `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Group *string                `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key   *string                `protobuf:"bytes,2,req,name=key" json:"key,omitempty"` // not actually required/guaranteed to be UTF-8
+	// value, if set, is saved under the key before it is got. The
+	// peer must have the CAP_PUT capability.
+	Value         []byte `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_groupcache_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func (m *GetRequest) Reset()         { *m = GetRequest{} }
-func (m *GetRequest) String() string { return proto.CompactTextString(m) }
-func (*GetRequest) ProtoMessage()    {}
+func (*GetRequest) ProtoMessage() {}
 
-func (m *GetRequest) GetGroup() string {
-	if m != nil && m.Group != nil {
-		return *m.Group
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetRequest) GetGroup() string {
+	if x != nil && x.Group != nil {
+		return *x.Group
 	}
 	return ""
 }
 
-func (m *GetRequest) GetKey() string {
-	if m != nil && m.Key != nil {
-		return *m.Key
+func (x *GetRequest) GetKey() string {
+	if x != nil && x.Key != nil {
+		return *x.Key
 	}
 	return ""
 }
-func (m *GetRequest) GetValue() []byte {
-	if m != nil {
-		return m.Value
+
+func (x *GetRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
 	}
 	return nil
 }
 
 type GetResponse struct {
-	Value            []byte   `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
-	MinuteQps        *float64 `protobuf:"fixed64,2,opt,name=minute_qps" json:"minute_qps,omitempty"`
-	XXX_unrecognized []byte   `json:"-"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Value     []byte                 `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
+	MinuteQps *float64               `protobuf:"fixed64,2,opt,name=minute_qps,json=minuteQps" json:"minute_qps,omitempty"`
+	// error is set instead of value when the key's load failed and
+	// the failure is negatively cached by the owner.
+	Error    *string `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+	NotFound *bool   `protobuf:"varint,4,opt,name=not_found,json=notFound" json:"not_found,omitempty"`
+	// ttl_ms is how much longer, in milliseconds, the response may be
+	// cached by the caller. Zero means no limit.
+	TtlMs *int64 `protobuf:"varint,5,opt,name=ttl_ms,json=ttlMs" json:"ttl_ms,omitempty"`
+	// error_code classifies error, which is then its message.
+	ErrorCode     *ErrorCode `protobuf:"varint,6,opt,name=error_code,json=errorCode,enum=groupcachepb.ErrorCode" json:"error_code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (m *GetResponse) Reset()         { *m = GetResponse{} }
-func (m *GetResponse) String() string { return proto.CompactTextString(m) }
-func (*GetResponse) ProtoMessage()    {}
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_groupcache_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
 
-func (m *GetResponse) GetValue() []byte {
-	if m != nil {
-		return m.Value
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetResponse) GetValue() []byte {
+	if x != nil {
+		return x.Value
 	}
 	return nil
 }
 
-func (m *GetResponse) GetMinuteQps() float64 {
-	if m != nil && m.MinuteQps != nil {
-		return *m.MinuteQps
+func (x *GetResponse) GetMinuteQps() float64 {
+	if x != nil && x.MinuteQps != nil {
+		return *x.MinuteQps
+	}
+	return 0
+}
+
+func (x *GetResponse) GetError() string {
+	if x != nil && x.Error != nil {
+		return *x.Error
+	}
+	return ""
+}
+
+func (x *GetResponse) GetNotFound() bool {
+	if x != nil && x.NotFound != nil {
+		return *x.NotFound
+	}
+	return false
+}
+
+func (x *GetResponse) GetTtlMs() int64 {
+	if x != nil && x.TtlMs != nil {
+		return *x.TtlMs
+	}
+	return 0
+}
+
+func (x *GetResponse) GetErrorCode() ErrorCode {
+	if x != nil && x.ErrorCode != nil {
+		return *x.ErrorCode
+	}
+	return ErrorCode_ERR_UNKNOWN
+}
+
+// Hello is exchanged by peers on first contact, so that peers of
+// different versions learn what each other supports. A peer that does
+// not understand Hello speaks version 0, without capabilities.
+type Hello struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       *uint32                `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Capabilities  *uint64                `protobuf:"varint,2,opt,name=capabilities" json:"capabilities,omitempty"` // bits of Capability
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_groupcache_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_groupcache_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_groupcache_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Hello) GetVersion() uint32 {
+	if x != nil && x.Version != nil {
+		return *x.Version
 	}
 	return 0
 }
 
-func init() {
+func (x *Hello) GetCapabilities() uint64 {
+	if x != nil && x.Capabilities != nil {
+		return *x.Capabilities
+	}
+	return 0
+}
+
+var File_groupcache_proto protoreflect.FileDescriptor
+
+const file_groupcache_proto_rawDesc = "" +
+	"\n" +
+	"\x10groupcache.proto\x12\fgroupcachepb\"J\n" +
+	"\n" +
+	"GetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x02(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x02(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\fR\x05value\"\xc4\x01\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\x12\x1d\n" +
+	"\n" +
+	"minute_qps\x18\x02 \x01(\x01R\tminuteQps\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x1b\n" +
+	"\tnot_found\x18\x04 \x01(\bR\bnotFound\x12\x15\n" +
+	"\x06ttl_ms\x18\x05 \x01(\x03R\x05ttlMs\x126\n" +
+	"\n" +
+	"error_code\x18\x06 \x01(\x0e2\x17.groupcachepb.ErrorCodeR\terrorCode\"E\n" +
+	"\x05Hello\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\"\n" +
+	"\fcapabilities\x18\x02 \x01(\x04R\fcapabilities*j\n" +
+	"\tErrorCode\x12\x0f\n" +
+	"\vERR_UNKNOWN\x10\x00\x12\x11\n" +
+	"\rERR_NOT_FOUND\x10\x01\x12\x0f\n" +
+	"\vERR_BACKEND\x10\x02\x12\x12\n" +
+	"\x0eERR_OVERLOADED\x10\x03\x12\x14\n" +
+	"\x10ERR_UNAUTHORIZED\x10\x04*^\n" +
+	"\n" +
+	"Capability\x12\v\n" +
+	"\aCAP_PUT\x10\x01\x12\x0f\n" +
+	"\vCAP_HANDOFF\x10\x02\x12\x13\n" +
+	"\x0fCAP_COMPRESSION\x10\x04\x12\x0e\n" +
+	"\n" +
+	"CAP_STREAM\x10\b\x12\r\n" +
+	"\tCAP_BATCH\x10\x102{\n" +
+	"\n" +
+	"GroupCache\x12:\n" +
+	"\x03Get\x12\x18.groupcachepb.GetRequest\x1a\x19.groupcachepb.GetResponse\x121\n" +
+	"\x05Hello\x12\x13.groupcachepb.Hello\x1a\x13.groupcachepb.HelloB+Z)github.com/golang/groupcache/groupcachepbb\x06proto2"
+
+var (
+	file_groupcache_proto_rawDescOnce sync.Once
+	file_groupcache_proto_rawDescData []byte
+)
+
+func file_groupcache_proto_rawDescGZIP() []byte {
+	file_groupcache_proto_rawDescOnce.Do(func() {
+		file_groupcache_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_groupcache_proto_rawDesc), len(file_groupcache_proto_rawDesc)))
+	})
+	return file_groupcache_proto_rawDescData
+}
+
+var file_groupcache_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_groupcache_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_groupcache_proto_goTypes = []any{
+	(ErrorCode)(0),      // 0: groupcachepb.ErrorCode
+	(Capability)(0),     // 1: groupcachepb.Capability
+	(*GetRequest)(nil),  // 2: groupcachepb.GetRequest
+	(*GetResponse)(nil), // 3: groupcachepb.GetResponse
+	(*Hello)(nil),       // 4: groupcachepb.Hello
+}
+var file_groupcache_proto_depIdxs = []int32{
+	0, // 0: groupcachepb.GetResponse.error_code:type_name -> groupcachepb.ErrorCode
+	2, // 1: groupcachepb.GroupCache.Get:input_type -> groupcachepb.GetRequest
+	4, // 2: groupcachepb.GroupCache.Hello:input_type -> groupcachepb.Hello
+	3, // 3: groupcachepb.GroupCache.Get:output_type -> groupcachepb.GetResponse
+	4, // 4: groupcachepb.GroupCache.Hello:output_type -> groupcachepb.Hello
+	3, // [3:5] is the sub-list for method output_type
+	1, // [1:3] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_groupcache_proto_init() }
+func file_groupcache_proto_init() {
+	if File_groupcache_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_groupcache_proto_rawDesc), len(file_groupcache_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_groupcache_proto_goTypes,
+		DependencyIndexes: file_groupcache_proto_depIdxs,
+		EnumInfos:         file_groupcache_proto_enumTypes,
+		MessageInfos:      file_groupcache_proto_msgTypes,
+	}.Build()
+	File_groupcache_proto = out.File
+	file_groupcache_proto_goTypes = nil
+	file_groupcache_proto_depIdxs = nil
 }
@@ -0,0 +1,162 @@
+package groupcachepb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	protoMessage = regexp.MustCompile(`(?s)\nmessage (\w+) \{(.*?)\n\}`)
+	protoField   = regexp.MustCompile(`(required|optional|repeated) \w+ (\w+) = (\d+);`)
+	protoEnum    = regexp.MustCompile(`(?s)\nenum (\w+) \{(.*?)\n\}`)
+	protoValue   = regexp.MustCompile(`(\w+) = (\d+);`)
+	protoRPC     = regexp.MustCompile(`rpc (\w+)\((\w+)\) returns \((\w+)\)`)
+)
+
+// TestProtoMatchesGo checks that groupcache.pb.go has the messages,
+// fields and enum values declared in groupcache.proto.
+func TestProtoMatchesGo(t *testing.T) {
+	src, err := ioutil.ReadFile("groupcache.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]reflect.Type{
+		"GetRequest":  reflect.TypeOf(GetRequest{}),
+		"GetResponse": reflect.TypeOf(GetResponse{}),
+		"Hello":       reflect.TypeOf(Hello{}),
+	}
+	for _, m := range protoMessage.FindAllStringSubmatch(string(src), -1) {
+		name, body := m[1], m[2]
+		typ, ok := types[name]
+		if !ok {
+			t.Errorf("message %s has no Go type", name)
+			continue
+		}
+		delete(types, name)
+		var want, got []string
+		for _, f := range protoField.FindAllStringSubmatch(body, -1) {
+			want = append(want, fmt.Sprintf("%s=%s,%s", f[2], f[3], f[1][:3]))
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			tag := typ.Field(i).Tag.Get("protobuf")
+			if tag == "" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			got = append(got, fmt.Sprintf("%s=%s,%s", strings.TrimPrefix(parts[3], "name="), parts[1], parts[2]))
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("message %s: Go fields %v; .proto fields %v", name, got, want)
+		}
+	}
+	for name := range types {
+		t.Errorf("Go type %s is not a message in groupcache.proto", name)
+	}
+
+	enums := map[string]map[string]int32{
+		"Capability": Capability_value,
+		"ErrorCode":  ErrorCode_value,
+	}
+	for _, m := range protoEnum.FindAllStringSubmatch(string(src), -1) {
+		values, ok := enums[m[1]]
+		if !ok {
+			t.Errorf("enum %s has no Go type", m[1])
+			continue
+		}
+		want := make(map[string]int32)
+		for _, v := range protoValue.FindAllStringSubmatch(m[2], -1) {
+			var n int32
+			fmt.Sscan(v[2], &n)
+			want[v[1]] = n
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("enum %s: Go values %v; .proto values %v", m[1], values, want)
+		}
+	}
+}
+
+// TestServiceMatchesGo checks that groupcache_grpc.pb.go has the
+// methods of the GroupCache service declared in groupcache.proto.
+func TestServiceMatchesGo(t *testing.T) {
+	src, err := ioutil.ReadFile("groupcache.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := reflect.TypeOf((*GroupCacheServer)(nil)).Elem()
+	rpcs := protoRPC.FindAllStringSubmatch(string(src), -1)
+	for _, rpc := range rpcs {
+		m, ok := server.MethodByName(rpc[1])
+		if !ok {
+			t.Errorf("rpc %s has no Go method", rpc[1])
+			continue
+		}
+		if in, out := m.Type.In(1).Elem().Name(), m.Type.Out(0).Elem().Name(); in != rpc[2] || out != rpc[3] {
+			t.Errorf("rpc %s: Go method takes %s and returns %s; .proto %s and %s", rpc[1], in, out, rpc[2], rpc[3])
+		}
+	}
+	// The unexported method keeps implementations forward compatible.
+	if n := server.NumMethod() - 1; n != len(rpcs) {
+		t.Errorf("GroupCacheServer has %d methods; groupcache.proto %d rpcs", n, len(rpcs))
+	}
+}
+
+// TestWireCompat checks that messages encoded by the hand-maintained
+// code that predated google.golang.org/protobuf decode to the same
+// values, and encode back to the same bytes.
+func TestWireCompat(t *testing.T) {
+	tests := []struct {
+		old  string // encoded by the old code
+		want proto.Message
+	}{
+		{
+			"\n\x05group\x12\x05key\x00\xff\x1a\x05value",
+			&GetRequest{Group: proto.String("group"), Key: proto.String("key\x00\xff"), Value: []byte("value")},
+		},
+		{
+			"\n\x05value\x11\x00\x00\x00\x00\x00\x00\xf8?(\xe0\xd4\x03",
+			&GetResponse{Value: []byte("value"), MinuteQps: proto.Float64(1.5), TtlMs: proto.Int64(60000)},
+		},
+		{
+			"\x1a\x06no row \x01(\x010\x01",
+			&GetResponse{Error: proto.String("no row"), NotFound: proto.Bool(true), TtlMs: proto.Int64(1), ErrorCode: ErrorCode_ERR_NOT_FOUND.Enum()},
+		},
+		{
+			"\b\x01\x10\t",
+			&Hello{Version: proto.Uint32(1), Capabilities: proto.Uint64(uint64(Capability_CAP_PUT | Capability_CAP_STREAM))},
+		},
+	}
+	for _, tt := range tests {
+		got := tt.want.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal([]byte(tt.old), got); err != nil {
+			t.Errorf("decoding %q: %v", tt.old, err)
+			continue
+		}
+		if !proto.Equal(got, tt.want) {
+			t.Errorf("decoding %q = %v; want %v", tt.old, got, tt.want)
+		}
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(got)
+		if err != nil || string(b) != tt.old {
+			t.Errorf("re-encoding %v = %q, %v; want %q", got, b, err, tt.old)
+		}
+	}
+
+	// Fields unknown to this version, such as those of newer
+	// peers, survive a round trip.
+	old := "\b\x01\x10\tx\x05"
+	hello := new(Hello)
+	if err := proto.Unmarshal([]byte(old), hello); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := proto.Marshal(hello); err != nil || string(b) != old {
+		t.Errorf("re-encoding %q with an unknown field = %q, %v", old, b, err)
+	}
+}
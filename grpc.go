@@ -0,0 +1,308 @@
+// grpc.go implements the GroupCache service of groupcache.proto over
+// gRPC, as an alternative to HTTPPool.
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCPool implements PeerPicker for a pool of gRPC peers, and serves
+// the GroupCache service to them.
+type GRPCPool struct {
+	// Context optionally specifies a context for the server to use
+	// when it receives a request. If nil, the server uses the
+	// request's context.Context, which carries the caller's
+	// deadline.
+	Context func(context.Context) Context
+
+	// this peer's address, e.g. "10.0.0.1:8008"
+	self string
+
+	// opts specifies the options.
+	opts GRPCPoolOptions
+
+	mu          sync.Mutex // guards peers and getters
+	peers       *consistenthash.Multi
+	grpcGetters map[string]*grpcGetter // keyed by address
+}
+
+// GRPCPoolOptions are the configurations of a GRPCPool.
+type GRPCPoolOptions struct {
+	// DialOptions are added to those the pool dials its peers
+	// with. Without credentials among them, peers are dialed
+	// insecurely.
+	DialOptions []grpc.DialOption
+
+	// ConnsPerPeer specifies how many connections to keep open to
+	// each peer; requests are spread across them. If zero, it
+	// defaults to 1.
+	ConnsPerPeer int
+
+	// Timeout, if positive, is the deadline of requests to peers
+	// whose Context carries none.
+	Timeout time.Duration
+
+	// KeepaliveTime, if positive, makes clients ping a peer after
+	// this long without activity, and servers accept such pings.
+	KeepaliveTime time.Duration
+
+	// KeepaliveTimeout specifies how long to wait for a keepalive
+	// ping to be answered before closing the connection. If zero,
+	// gRPC's default of 20 seconds applies.
+	KeepaliveTimeout time.Duration
+}
+
+// NewGRPCPool initializes a gRPC pool of peers with the given options,
+// and registers it as the PeerPicker unless one is registered already.
+// The self argument is the address this peer serves on, as it
+// appears in the list passed to Set. The pool serves its peers once
+// registered with a grpc.Server using Register.
+func NewGRPCPool(self string, o *GRPCPoolOptions) *GRPCPool {
+	p := &GRPCPool{
+		self:        self,
+		peers:       consistenthash.NewmpcHash(6000, 1, siphash64seed, [2]uint64{1, 2}, 21),
+		grpcGetters: make(map[string]*grpcGetter),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	registerDefaultPeerPicker(func() PeerPicker { return p })
+	return p
+}
+
+// Set updates the pool's list of peers, given as addresses.
+// Connections to peers that remain are kept.
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	p.peers = consistenthash.NewmpcHash(6000, 1, siphash64seed, [2]uint64{1, 2}, 21)
+	p.peers.Add(peers...)
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if h, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = h
+			delete(p.grpcGetters, peer)
+			continue
+		}
+		if peer != p.self {
+			getters[peer] = &grpcGetter{pool: p, addr: peer}
+		}
+	}
+	for _, h := range p.grpcGetters {
+		h.close()
+	}
+	p.grpcGetters = getters
+	live := make([]ProtoGetter, 0, len(getters))
+	for _, h := range getters {
+		live = append(live, h)
+	}
+	p.mu.Unlock()
+	forgetPeers(p, live)
+}
+
+// Close closes the pool's connections to its peers and forgets them,
+// so that keys are loaded locally until Set is called again.
+func (p *GRPCPool) Close() {
+	p.mu.Lock()
+	for _, h := range p.grpcGetters {
+		h.close()
+	}
+	p.grpcGetters = make(map[string]*grpcGetter)
+	p.peers = consistenthash.NewmpcHash(6000, 1, siphash64seed, [2]uint64{1, 2}, 21)
+	p.mu.Unlock()
+	forgetPeers(p, nil)
+}
+
+func (p *GRPCPool) PickPeer(key string) (ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil, false
+	}
+	if peer := p.peers.Hash(key); peer[0] != p.self {
+		return p.grpcGetters[peer[0]], true
+	}
+	return nil, false
+}
+
+func (p *GRPCPool) PickN(key string, n int) []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil
+	}
+	var peers []ProtoGetter
+	for _, peer := range p.peers.HashN(key, n) {
+		if peer == p.self {
+			break
+		}
+		peers = append(peers, p.grpcGetters[peer])
+	}
+	return peers
+}
+
+// Register registers the pool's GroupCache service with s.
+func (p *GRPCPool) Register(s *grpc.Server) {
+	pb.RegisterGroupCacheServer(s, grpcServer{pool: p})
+}
+
+// ServerOptions returns the options a grpc.Server serving the pool
+// should be created with, to accept the pool's keepalive pings.
+func (p *GRPCPool) ServerOptions() []grpc.ServerOption {
+	if p.opts.KeepaliveTime <= 0 {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             p.opts.KeepaliveTime,
+			PermitWithoutStream: true,
+		}),
+	}
+}
+
+// get serves a peer's Get.
+func (p *GRPCPool) get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	group := servedGroup(in.GetGroup(), p)
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", in.GetGroup())
+	}
+	var gctx Context = ctx
+	if p.Context != nil {
+		gctx = p.Context(ctx)
+	}
+	res := group.servePeer(gctx, in.GetKey(), in.GetValue())
+	if res.Error != nil && ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return res, nil
+}
+
+// hello answers a peer's Hello with the pool's.
+func (p *GRPCPool) hello(ctx context.Context, in *pb.Hello) (*pb.Hello, error) {
+	return grpcHello(), nil
+}
+
+// grpcServer serves the GroupCache service of a GRPCPool.
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServer
+	pool *GRPCPool
+}
+
+func (s grpcServer) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	return s.pool.get(ctx, in)
+}
+
+func (s grpcServer) Hello(ctx context.Context, in *pb.Hello) (*pb.Hello, error) {
+	return s.pool.hello(ctx, in)
+}
+
+// grpcGetter is the ProtoGetter of one gRPC peer.
+type grpcGetter struct {
+	pool *GRPCPool
+	addr string
+
+	mu     sync.Mutex // guards conns and closed
+	conns  []*grpc.ClientConn
+	closed bool // set by close, after which nothing is dialed
+	next   uint32
+
+	hello peerHello
+}
+
+// errGetterClosed is returned by the getters of peers removed from a
+// GRPCPool.
+var errGetterClosed = errors.New("groupcache: peer removed from the pool")
+
+// conn returns one of the connections to h's peer, dialing them on
+// first use. A failed dial is tried again by the next call.
+func (h *grpcGetter) conn() (*grpc.ClientConn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, errGetterClosed
+	}
+	if h.conns == nil {
+		n := h.pool.opts.ConnsPerPeer
+		if n <= 0 {
+			n = 1
+		}
+		conns := make([]*grpc.ClientConn, 0, n)
+		for i := 0; i < n; i++ {
+			cc, err := grpc.NewClient(h.target(), h.dialOptions()...)
+			if err != nil {
+				for _, cc := range conns {
+					cc.Close()
+				}
+				return nil, err
+			}
+			conns = append(conns, cc)
+		}
+		h.conns = conns
+	}
+	i := atomic.AddUint32(&h.next, 1)
+	return h.conns[i%uint32(len(h.conns))], nil
+}
+
+// target returns the gRPC target of h's peer. Plain addresses are
+// dialed as they are, without name resolution by gRPC.
+func (h *grpcGetter) target() string {
+	if strings.Contains(h.addr, ":///") {
+		return h.addr
+	}
+	return "passthrough:///" + h.addr
+}
+
+func (h *grpcGetter) dialOptions() []grpc.DialOption {
+	o := &h.pool.opts
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if o.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.KeepaliveTime,
+			Timeout:             o.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	// Later options win, so the caller's credentials replace
+	// the insecure default.
+	return append(opts, o.DialOptions...)
+}
+
+func (h *grpcGetter) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, cc := range h.conns {
+		cc.Close()
+	}
+	h.conns = nil
+}
+
+func (h *grpcGetter) Get(ctx Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	cc, err := h.conn()
+	if err != nil {
+		return err
+	}
+	c, ok := ctx.(context.Context)
+	if !ok {
+		c = context.Background()
+	}
+	if _, ok := c.Deadline(); !ok && h.pool.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, h.pool.opts.Timeout)
+		defer cancel()
+	}
+	return grpcError(cc.Invoke(c, pb.GroupCache_Get_FullMethodName, in, out))
+}
@@ -0,0 +1,167 @@
+package groupcache
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// bufconnPeers serves gRPC pools on in-process listeners, keyed by
+// address.
+type bufconnPeers map[string]*bufconn.Listener
+
+func (b bufconnPeers) serve(t *testing.T, addr string, p *GRPCPool) {
+	l := bufconn.Listen(1 << 20)
+	b[addr] = l
+	s := grpc.NewServer(p.ServerOptions()...)
+	p.Register(s)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+}
+
+func (b bufconnPeers) dialer() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return b[addr].DialContext(ctx)
+	})
+}
+
+func TestGRPCPool(t *testing.T) {
+	peers := make(bufconnPeers)
+
+	deadlines := make(chan bool, 1)
+	server := &GRPCPool{self: "server"}
+	server.Set("server")
+	g := NewGroupOpts("grpcTest", 1<<20, GetterFunc(func(ctx Context, key string, dest Sink) error {
+		switch key {
+		case "absent":
+			return ErrNotFound
+		case "slow":
+			c := ctx.(context.Context)
+			_, ok := c.Deadline()
+			deadlines <- ok
+			<-c.Done()
+			return c.Err()
+		}
+		return dest.SetString("server:" + key)
+	}), &GroupOptions{Peers: server, NegativeCacheTTL: time.Minute})
+	defer DeregisterGroup(g.Name())
+	peers.serve(t, "server", server)
+
+	client := &GRPCPool{self: "client", opts: GRPCPoolOptions{
+		DialOptions:   []grpc.DialOption{peers.dialer()},
+		ConnsPerPeer:  2,
+		KeepaliveTime: time.Minute,
+	}}
+	defer client.Close()
+	client.Set("server")
+	peer, ok := client.PickPeer("k")
+	if !ok {
+		t.Fatal("PickPeer found no peer")
+	}
+
+	get := func(ctx Context, group, key string) (*pb.GetResponse, error) {
+		out := new(pb.GetResponse)
+		err := peer.Get(ctx, &pb.GetRequest{Group: proto.String(group), Key: proto.String(key)}, out)
+		return out, err
+	}
+	for i := 0; i < 3; i++ {
+		res, err := get(nil, "grpcTest", "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Value) != "server:k" {
+			t.Errorf("value = %q; want %q", res.Value, "server:k")
+		}
+	}
+	if got := g.Stats.ServerRequests.Get(); got != 3 {
+		t.Errorf("ServerRequests = %d; want 3", got)
+	}
+
+	res, err := get(nil, "grpcTest", "absent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.GetNotFound() || res.GetTtlMs() <= 0 {
+		t.Errorf("response for absent key = %v; want a not-found error with a TTL", res)
+	}
+
+	if _, err := get(nil, "noSuchGroup", "k"); status.Code(err) != codes.NotFound {
+		t.Errorf("Get from unknown group = %v; want code NotFound", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := get(ctx, "grpcTest", "slow"); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Get past deadline = %v; want code DeadlineExceeded", err)
+	}
+	if !<-deadlines {
+		t.Error("deadline was not propagated to the server")
+	}
+}
+
+func TestGRPCPoolPicks(t *testing.T) {
+	p := &GRPCPool{self: "a:1"}
+	defer p.Close()
+	p.Set("a:1", "b:1", "c:1")
+	remote := 0
+	for _, key := range testKeys(100) {
+		if peer, ok := p.PickPeer(key); ok {
+			remote++
+			if addr := peer.(*grpcGetter).addr; !strings.HasSuffix(addr, ":1") || addr == "a:1" {
+				t.Errorf("PickPeer(%q) = %s", key, addr)
+			}
+		}
+	}
+	if remote == 0 || remote == 100 {
+		t.Errorf("%d of 100 keys owned by other peers", remote)
+	}
+}
+
+func TestGRPCGetterClosed(t *testing.T) {
+	p := &GRPCPool{self: "a:1"}
+	defer p.Close()
+	p.Set("a:1", "b:1")
+	h := p.grpcGetters["b:1"]
+	if _, err := h.conn(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Get still running when its peer is removed opens nothing
+	// that would never be closed.
+	p.Set("a:1")
+	if cc, err := h.conn(); err != errGetterClosed {
+		t.Errorf("conn after close = %v, %v; want %v", cc, err, errGetterClosed)
+	}
+	if len(h.conns) != 0 {
+		t.Errorf("removed getter holds %d connections", len(h.conns))
+	}
+}
+
+func TestGRPCPoolClosed(t *testing.T) {
+	p := &GRPCPool{self: "a:1"}
+	g := NewGroupOpts("TestGRPCPoolClosed-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+	p.Set("a:1", "b:1", "c:1")
+	p.Close()
+
+	for _, key := range testKeys(10) {
+		var s string
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if want := "local:" + key; s != want {
+			t.Errorf("Get(%q) after Close = %q; want %q", key, s, want)
+		}
+	}
+}
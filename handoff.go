@@ -0,0 +1,117 @@
+// handoff.go moves cached values to their new owners when the peers of
+// an HTTPPool change.
+
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultHandoffTimeout bounds each handoff PUT when the pool has no
+// RequestTimeout, so that one hung peer does not stall the handoff.
+const defaultHandoffTimeout = 10 * time.Second
+
+// handoff pushes the mainCache entries of the pool's groups whose
+// keys this peer owned in old but another peer owns in cur to that
+// peer. It stops early, even mid-PUT or while rate limited, once ctx
+// is canceled by the next Set or by Close, and skips the rest of a
+// group that is deregistered.
+func (p *HTTPPool) handoff(ctx context.Context, old, cur *consistenthash.Multi, getters map[string]*httpGetter) {
+	for _, g := range groupsUsing(p) {
+		for _, ke := range g.mainCache.entries() {
+			if ctx.Err() != nil {
+				return
+			}
+			if GetGroup(g.name) != g {
+				break
+			}
+			if ke.err != nil || old.Hash(ke.key)[0] != p.self {
+				continue
+			}
+			owner := cur.Hash(ke.key)[0]
+			if owner == p.self {
+				continue
+			}
+			p.Stats.HandoffKeys.Add(1)
+			res := &pb.GetResponse{Value: ke.value.ByteSlice()}
+			if !ke.expire.IsZero() {
+				ttl := int64(ke.expire.Sub(timeNow()) / time.Millisecond)
+				if ttl <= 0 {
+					continue
+				}
+				res.TtlMs = proto.Int64(ttl)
+			}
+			if err := getters[owner].put(ctx, g.name, ke.key, res); err != nil {
+				p.Stats.HandoffErrors.Add(1)
+				continue
+			}
+			g.mainCache.remove(ke.key)
+			p.Stats.HandoffSent.Add(1)
+			p.Stats.HandoffBytes.Add(int64(len(res.Value)))
+			if !sleepContext(ctx, time.Duration(len(res.Value))*time.Second/time.Duration(p.opts.HandoffBytesPerSecond)) {
+				return
+			}
+		}
+	}
+	p.Stats.HandoffsDone.Add(1)
+}
+
+// receiveHandoff serves a PUT of a value handed off by its previous
+// owner, whose request body is body, caching it in group's mainCache.
+func (p *HTTPPool) receiveHandoff(w http.ResponseWriter, group *Group, key string, body []byte) {
+	res := new(pb.GetResponse)
+	if err := proto.Unmarshal(body, res); err != nil {
+		httpError(w, http.StatusBadRequest, "bad_handoff", "decoding handoff: "+err.Error())
+		return
+	}
+	e := group.newEntry(ByteView{b: res.Value})
+	if ttl := res.GetTtlMs(); ttl > 0 {
+		expire := timeNow().Add(time.Duration(ttl) * time.Millisecond)
+		if e.expire.IsZero() || expire.Before(e.expire) {
+			e.expire = expire
+		}
+	}
+	group.populateCache(key, e, &group.mainCache)
+	p.Stats.HandoffReceived.Add(1)
+}
+
+// put hands off the value in res for key in group to h's peer, giving
+// up after the pool's RequestTimeout or defaultHandoffTimeout.
+func (h *httpGetter) put(ctx context.Context, group, key string, res *pb.GetResponse) error {
+	if !supports(ctx, h, pb.Capability_CAP_HANDOFF) {
+		return errUnsupported
+	}
+	body, err := proto.Marshal(res)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", h.url(group, key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if err := h.sign(req, body); err != nil {
+		return err
+	}
+	timeout := defaultHandoffTimeout
+	if h.pool != nil && h.pool.opts.RequestTimeout > 0 {
+		timeout = h.pool.opts.RequestTimeout
+	}
+	c, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := h.roundTripper(ctx).RoundTrip(req.WithContext(c))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return nil
+}
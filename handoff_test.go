@@ -0,0 +1,196 @@
+package groupcache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandoff(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{
+		self:        self,
+		opts:        HTTPPoolOptions{BasePath: defaultBasePath, HandoffBytesPerSecond: 1 << 30},
+		httpGetters: make(map[string]*httpGetter),
+	}
+	p.Set(self)
+	g := NewGroupOpts("TestHandoff-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value-of-" + key)
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+
+	const nKeys = 50
+	for i := 0; i < nKeys; i++ {
+		var s string
+		if err := g.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		received = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == defaultBasePath+helloPath {
+			b, _ := proto.Marshal(newHello(pb.Capability_CAP_HANDOFF))
+			w.Write(b)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		res := new(pb.GetResponse)
+		if r.Method != "PUT" || proto.Unmarshal(body, res) != nil {
+			http.Error(w, "bad handoff", http.StatusBadRequest)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, defaultBasePath+g.Name()+"/")
+		mu.Lock()
+		received[key] = string(res.Value)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	p.Set(self, srv.URL)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats.HandoffsDone.Get() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("handoff incomplete after %d keys", p.Stats.HandoffKeys.Get())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(received) == 0 || len(received) == nKeys {
+		t.Fatalf("%d of %d keys handed off; want some", len(received), nKeys)
+	}
+	for key, value := range received {
+		if owner := p.peers.Hash(key)[0]; owner != srv.URL {
+			t.Errorf("key %q handed off, but owned by %q", key, owner)
+		}
+		if want := "value-of-" + key; value != want {
+			t.Errorf("key %q handed off with %q; want %q", key, value, want)
+		}
+	}
+	for _, ke := range g.mainCache.entries() {
+		if owner := p.peers.Hash(ke.key)[0]; owner != self {
+			t.Errorf("key %q owned by %q was not handed off", ke.key, owner)
+		}
+	}
+	if got := p.Stats.HandoffSent.Get(); got != int64(len(received)) {
+		t.Errorf("HandoffSent = %d; want %d", got, len(received))
+	}
+}
+
+// hungHandoffPeer starts a peer supporting handoff that never answers
+// a PUT, sending on puts as each arrives and once more when it is
+// canceled.
+func hungHandoffPeer(puts chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == defaultBasePath+helloPath {
+			b, _ := proto.Marshal(newHello(pb.Capability_CAP_HANDOFF))
+			w.Write(b)
+			return
+		}
+		ioutil.ReadAll(r.Body) // so that the server notices the cancellation
+		puts <- "put"
+		<-r.Context().Done()
+		puts <- "canceled"
+	}))
+}
+
+// handoffGroup returns a group bound to p caching nKeys values.
+func handoffGroup(t *testing.T, name string, p *HTTPPool, nKeys int) *Group {
+	g := NewGroupOpts(name, cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value-of-" + key)
+	}), &GroupOptions{Peers: p})
+	for i := 0; i < nKeys; i++ {
+		var s string
+		if err := g.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+func TestHandoffHungPeer(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{BasePath: defaultBasePath, HandoffBytesPerSecond: 1 << 30, RequestTimeout: 20 * time.Millisecond}}
+	p.Set(self)
+	g := handoffGroup(t, "TestHandoffHungPeer-group", p, 20)
+	defer DeregisterGroup(g.Name())
+
+	puts := make(chan string, 100)
+	srv := hungHandoffPeer(puts)
+	defer srv.Close()
+
+	p.Set(self, srv.URL)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats.HandoffsDone.Get() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("handoff to a hung peer incomplete after %d keys", p.Stats.HandoffKeys.Get())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if keys, errs := p.Stats.HandoffKeys.Get(), p.Stats.HandoffErrors.Get(); keys == 0 || errs != keys {
+		t.Errorf("%d handoff errors of %d keys; want all of some", errs, keys)
+	}
+}
+
+func TestHandoffCanceled(t *testing.T) {
+	const self = "http://self"
+	p := &HTTPPool{self: self, opts: HTTPPoolOptions{BasePath: defaultBasePath, HandoffBytesPerSecond: 1}}
+	p.Set(self)
+	g := handoffGroup(t, "TestHandoffCanceled-group", p, 20)
+	defer DeregisterGroup(g.Name())
+
+	puts := make(chan string, 100)
+	srv := hungHandoffPeer(puts)
+	defer srv.Close()
+
+	p.Set(self, srv.URL)
+	if got := <-puts; got != "put" {
+		t.Fatalf("peer saw %q; want a put", got)
+	}
+	p.Set(self)
+	select {
+	case got := <-puts:
+		if got != "canceled" {
+			t.Errorf("peer saw %q; want the put canceled", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("put still running after Set")
+	}
+}
+
+func TestReceiveHandoff(t *testing.T) {
+	g := NewGroup("TestReceiveHandoff-group", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return fmt.Errorf("unexpected load of %q", key)
+	}))
+	defer DeregisterGroup(g.Name())
+
+	body, err := proto.Marshal(&pb.GetResponse{Value: []byte("handed-off"), TtlMs: proto.Int64(60000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("PUT", defaultBasePath+g.Name()+"/k", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	e, ok := g.mainCache.get("k")
+	if !ok || e.value.String() != "handed-off" || e.expire.IsZero() {
+		t.Errorf("cached entry = %+v, %v; want the handed-off value with an expiry", e, ok)
+	}
+}
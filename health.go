@@ -0,0 +1,268 @@
+// health.go checks the health of an HTTPPool's peers, and removes
+// unhealthy peers from the placement until they recover.
+
+package groupcache
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/consistenthash"
+)
+
+// healthPath is the path, under the pool's BasePath, of the health
+// endpoint.
+const healthPath = "_health"
+
+const (
+	defaultHealthCheckTimeout = time.Second
+	defaultUnhealthyThreshold = 2
+	defaultOutlierEjectFor    = 30 * time.Second
+
+	// outlierCheckInterval is how often ejected peers are
+	// reconsidered when there are no active health checks.
+	outlierCheckInterval = time.Second
+)
+
+// peerHealth is what a pool knows about the health of one peer.
+type peerHealth struct {
+	checkFailures int // health checks failed in a row
+	requestErrors int // requests failed in a row
+	down          bool
+	downSince     time.Time
+}
+
+// UnhealthyPeers returns the peers currently removed from the
+// placement for being unhealthy, sorted.
+func (p *HTTPPool) UnhealthyPeers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []string
+	for peer, h := range p.health {
+		if h.down {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// placeLocked rebuilds the placement from the members that are not
+// down. p.mu must be held.
+func (p *HTTPPool) placeLocked() {
+	p.placement++
+	p.peers = consistenthash.NewmpcHash(6000, 1, siphash64seed, [2]uint64{1, 2}, 21)
+	for _, peer := range p.members {
+		if h := p.health[peer]; h == nil || !h.down || peer == p.self {
+			p.peers.Add(peer)
+		}
+	}
+}
+
+// healthLocked returns the health of peer, or nil if peer is not
+// a member. p.mu must be held.
+func (p *HTTPPool) healthLocked(peer string) *peerHealth {
+	if h, ok := p.health[peer]; ok {
+		return h
+	}
+	for _, m := range p.members {
+		if m == peer {
+			if p.health == nil {
+				p.health = make(map[string]*peerHealth)
+			}
+			h := new(peerHealth)
+			p.health[peer] = h
+			return h
+		}
+	}
+	return nil
+}
+
+// markLocked marks peer as down or up, rebuilding the placement if
+// that changed anything, and reports whether it did. p.mu must be
+// held.
+func (p *HTTPPool) markLocked(peer string, h *peerHealth, down bool) bool {
+	if h.down == down || peer == p.self {
+		return false
+	}
+	h.down = down
+	h.checkFailures = 0
+	h.requestErrors = 0
+	if down {
+		h.downSince = timeNow()
+		p.Stats.PeersEjected.Add(1)
+	}
+	p.placeLocked()
+	return true
+}
+
+// notify calls HealthChanged, if set, for peer.
+func (p *HTTPPool) notify(peer string, healthy bool) {
+	if p.HealthChanged != nil {
+		p.HealthChanged(peer, healthy)
+	}
+}
+
+// requestFailed records a failed request to h's peer, for passive
+// health checks.
+func (h *httpGetter) requestFailed() {
+	p := h.pool
+	if p == nil || p.opts.OutlierErrors <= 0 {
+		return
+	}
+	p.mu.Lock()
+	ph := p.healthLocked(h.peer)
+	changed := false
+	if ph != nil && !ph.down {
+		ph.requestErrors++
+		if ph.requestErrors >= p.opts.OutlierErrors {
+			changed = p.markLocked(h.peer, ph, true)
+		}
+	}
+	p.mu.Unlock()
+	if changed {
+		p.notify(h.peer, false)
+	}
+}
+
+// requestSucceeded records a successful request to h's peer.
+func (h *httpGetter) requestSucceeded() {
+	p := h.pool
+	if p == nil || p.opts.OutlierErrors <= 0 {
+		return
+	}
+	p.mu.Lock()
+	if ph := p.health[h.peer]; ph != nil {
+		ph.requestErrors = 0
+	}
+	p.mu.Unlock()
+}
+
+// checkHealth runs one round of health checks. With active checks
+// enabled, every peer but self is probed; otherwise peers ejected
+// for failed requests are added back once OutlierEjectFor has
+// passed.
+func (p *HTTPPool) checkHealth() {
+	if p.opts.HealthCheckInterval <= 0 {
+		p.readmitOutliers()
+		return
+	}
+	timeout := p.opts.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	threshold := p.opts.UnhealthyThreshold
+	if threshold <= 0 {
+		threshold = defaultUnhealthyThreshold
+	}
+
+	p.mu.Lock()
+	var getters []*httpGetter
+	for _, peer := range p.members {
+		if peer != p.self && p.httpGetters[peer] != nil {
+			getters = append(getters, p.httpGetters[peer])
+		}
+	}
+	p.mu.Unlock()
+
+	ok := make([]bool, len(getters))
+	var wg sync.WaitGroup
+	for i, h := range getters {
+		wg.Add(1)
+		go func(i int, h *httpGetter) {
+			defer wg.Done()
+			p.Stats.HealthChecks.Add(1)
+			if ok[i] = h.checkHealth(timeout); !ok[i] {
+				p.Stats.HealthCheckErrs.Add(1)
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	var changed []*httpGetter
+	var healthy []bool
+	p.mu.Lock()
+	for i, h := range getters {
+		if p.httpGetters[h.peer] != h {
+			continue // removed or replaced by Set meanwhile
+		}
+		ph := p.healthLocked(h.peer)
+		if ph == nil {
+			continue
+		}
+		if ok[i] {
+			ph.checkFailures = 0
+			if p.markLocked(h.peer, ph, false) {
+				changed, healthy = append(changed, h), append(healthy, true)
+			}
+			continue
+		}
+		ph.checkFailures++
+		if ph.checkFailures >= threshold && p.markLocked(h.peer, ph, true) {
+			changed, healthy = append(changed, h), append(healthy, false)
+		}
+	}
+	p.mu.Unlock()
+	for i, h := range changed {
+		p.notify(h.peer, healthy[i])
+	}
+}
+
+// readmitOutliers adds back the peers ejected for failed requests
+// more than OutlierEjectFor ago.
+func (p *HTTPPool) readmitOutliers() {
+	ejectFor := p.opts.OutlierEjectFor
+	if ejectFor <= 0 {
+		ejectFor = defaultOutlierEjectFor
+	}
+	now := timeNow()
+	var readmitted []string
+	p.mu.Lock()
+	for peer, ph := range p.health {
+		if ph.down && now.Sub(ph.downSince) >= ejectFor && p.markLocked(peer, ph, false) {
+			readmitted = append(readmitted, peer)
+		}
+	}
+	p.mu.Unlock()
+	for _, peer := range readmitted {
+		p.notify(peer, true)
+	}
+}
+
+// healthLoop runs health checks until stop is closed.
+func (p *HTTPPool) healthLoop(stop <-chan struct{}) {
+	interval := p.opts.HealthCheckInterval
+	if interval <= 0 {
+		interval = outlierCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.checkHealth()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkHealth requests the health endpoint of h's peer and reports
+// whether it answered OK within timeout.
+func (h *httpGetter) checkHealth(timeout time.Duration) bool {
+	req, err := http.NewRequest("GET", h.baseURL+healthPath, nil)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	res, err := h.roundTripper(nil).RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode == http.StatusOK
+}
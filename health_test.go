@@ -0,0 +1,167 @@
+package groupcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// healthServer serves the health endpoint of a peer, failing while
+// its down field is set.
+type healthServer struct {
+	mu   sync.Mutex
+	down bool
+}
+
+func (s *healthServer) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func (s *healthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	down := s.down
+	s.mu.Unlock()
+	if down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	p.ServeHTTP(w, r)
+}
+
+type healthEvent struct {
+	peer    string
+	healthy bool
+}
+
+func TestHealthChecks(t *testing.T) {
+	good := httptest.NewServer(new(healthServer))
+	defer good.Close()
+	flaky := new(healthServer)
+	bad := httptest.NewServer(flaky)
+	defer bad.Close()
+
+	var events []healthEvent
+	p := &HTTPPool{
+		self: "http://self",
+		opts: HTTPPoolOptions{
+			BasePath:            defaultBasePath,
+			HealthCheckInterval: time.Hour, // checks are run by hand
+			UnhealthyThreshold:  2,
+		},
+		HealthChanged: func(peer string, healthy bool) {
+			events = append(events, healthEvent{peer, healthy})
+		},
+	}
+	p.Set("http://self", good.URL, bad.URL)
+
+	owned := func(peer string) int {
+		n := 0
+		for _, key := range testKeys(200) {
+			if g, ok := p.PickPeer(key); ok && g.(*httpGetter).peer == peer {
+				n++
+			}
+		}
+		return n
+	}
+	if owned(bad.URL) == 0 {
+		t.Fatal("peer owns no keys to begin with")
+	}
+
+	flaky.setDown(true)
+	p.checkHealth()
+	if len(p.UnhealthyPeers()) != 0 {
+		t.Fatal("peer removed after a single failed check")
+	}
+	p.checkHealth()
+	if got, want := p.UnhealthyPeers(), []string{bad.URL}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("UnhealthyPeers = %v; want %v", got, want)
+	}
+	if n := owned(bad.URL); n != 0 {
+		t.Errorf("unhealthy peer still picked for %d keys", n)
+	}
+	if owned(good.URL) == 0 {
+		t.Error("healthy peer picked for no keys")
+	}
+
+	flaky.setDown(false)
+	p.checkHealth()
+	if len(p.UnhealthyPeers()) != 0 || owned(bad.URL) == 0 {
+		t.Error("recovered peer was not added back")
+	}
+
+	want := []healthEvent{{bad.URL, false}, {bad.URL, true}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("HealthChanged calls = %v; want %v", events, want)
+	}
+	if got := p.Stats.PeersEjected.Get(); got != 1 {
+		t.Errorf("PeersEjected = %d; want 1", got)
+	}
+	if got := p.Stats.HealthCheckErrs.Get(); got != 2 {
+		t.Errorf("HealthCheckErrs = %d; want 2", got)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	var now time.Time
+	defer setTimeNow(&now)()
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	p := &HTTPPool{
+		self: "http://self",
+		opts: HTTPPoolOptions{
+			BasePath:        defaultBasePath,
+			OutlierErrors:   3,
+			OutlierEjectFor: time.Minute,
+		},
+	}
+	p.Set("http://self", bad.URL)
+	h := p.httpGetters[bad.URL]
+
+	for i := 0; i < 3; i++ {
+		if len(p.UnhealthyPeers()) != 0 {
+			t.Fatalf("peer removed after %d failed requests", i)
+		}
+		if err := h.Get(nil, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("k")}, new(pb.GetResponse)); err == nil {
+			t.Fatal("Get from broken peer succeeded")
+		}
+	}
+	if got, want := p.UnhealthyPeers(), []string{bad.URL}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("UnhealthyPeers = %v; want %v", got, want)
+	}
+	if g, ok := p.PickPeer("k"); ok {
+		t.Errorf("PickPeer = %v; want no remote peer", g)
+	}
+
+	now = now.Add(59 * time.Second)
+	p.checkHealth()
+	if len(p.UnhealthyPeers()) == 0 {
+		t.Fatal("peer added back before OutlierEjectFor")
+	}
+	now = now.Add(time.Second)
+	p.checkHealth()
+	if len(p.UnhealthyPeers()) != 0 {
+		t.Error("peer not added back after OutlierEjectFor")
+	}
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", defaultBasePath+healthPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,191 @@
+// hedge.go sends duplicate loads past a slow peer, so that one slow
+// peer does not set the latency of a Get.
+
+package groupcache
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	// hedgeSamples is how many recent latencies of each peer are
+	// kept for HedgeAtP95.
+	hedgeSamples = 100
+
+	// hedgeMinSamples is how many latencies of a peer must be
+	// known before its 95th percentile is used.
+	hedgeMinSamples = 20
+)
+
+// latencyWindow holds the most recent latencies of loads from a peer.
+type latencyWindow struct {
+	samples [hedgeSamples]time.Duration
+	n       int // samples recorded, ever
+}
+
+// loadHedged loads key from the first of peers, hedging to the next
+// one, and finally to a local load, whenever the latest try is slow
+// or fails.
+func (g *Group) loadHedged(ctx Context, key string, peers []ProtoGetter) (ByteView, error) {
+	var live []ProtoGetter
+	for _, peer := range peers {
+		if !g.ejected(peer) {
+			live = append(live, peer)
+		}
+	}
+	peers = live
+
+	hctx, cancel := cancelableContext(ctx)
+	defer cancel()
+
+	type result struct {
+		i     int
+		value ByteView
+		err   error
+		took  time.Duration
+	}
+	n := len(peers) + 1 // the last try is local
+	results := make(chan result, n)
+	hedged := make([]bool, n)
+	start := func(i int) {
+		go func() {
+			if i == len(peers) {
+				var dest ByteView
+				value, err := g.loadLocally(hctx, key, ByteViewSink(&dest))
+				results <- result{i: i, value: value, err: err}
+				return
+			}
+			t0 := time.Now()
+			value, err := g.getFromPeer(hctx, peers[i], key)
+			results <- result{i, value, err, time.Since(t0)}
+		}()
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	// startNext starts the next try, and arms the timer to hedge it.
+	next, pending := 0, 0
+	startNext := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		start(next)
+		if next < len(peers) {
+			timer.Reset(g.hedgeDelay(peers[next]))
+		}
+		next++
+		pending++
+	}
+	startNext()
+
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < n {
+				g.Stats.HedgesIssued.Add(1)
+				hedged[next] = true
+				startNext()
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil && hedged[r.i] {
+				g.Stats.HedgesWon.Add(1)
+			}
+			if r.i == len(peers) {
+				// A local load is the last resort; its
+				// answer is final.
+				return r.value, r.err
+			}
+			peer := peers[r.i]
+			if r.err == nil {
+				g.peerSucceeded(peer)
+				g.recordLatency(peer, r.took)
+				g.Stats.PeerLoads.Add(1)
+				if r.i > 0 {
+					g.Stats.PeerFallbacks.Add(1)
+				}
+				return r.value, nil
+			}
+			if finalPeerError(r.err) {
+				g.peerSucceeded(peer)
+				g.Stats.PeerLoads.Add(1)
+				return ByteView{}, r.err
+			}
+			g.Stats.PeerErrors.Add(1)
+			g.peerFailed(peer, key, r.err)
+			err = r.err
+			if next < n {
+				startNext()
+			}
+		}
+	}
+	return ByteView{}, err
+}
+
+// hedgeDelay returns how long to wait for peer before hedging.
+func (g *Group) hedgeDelay(peer ProtoGetter) time.Duration {
+	if g.opts.HedgeAtP95 {
+		if d, ok := g.peerP95(peer); ok {
+			return d
+		}
+	}
+	return g.opts.HedgeAfter
+}
+
+// recordLatency records how long a successful load from peer took.
+func (g *Group) recordLatency(peer ProtoGetter, d time.Duration) {
+	if !g.opts.HedgeAtP95 {
+		return
+	}
+	g.latencyMu.Lock()
+	defer g.latencyMu.Unlock()
+	if g.latencies == nil {
+		g.latencies = make(map[ProtoGetter]*latencyWindow)
+	}
+	w := g.latencies[peer]
+	if w == nil {
+		w = new(latencyWindow)
+		g.latencies[peer] = w
+	}
+	w.samples[w.n%hedgeSamples] = d
+	w.n++
+}
+
+// peerP95 returns the 95th percentile of peer's recent latencies,
+// if enough are known.
+func (g *Group) peerP95(peer ProtoGetter) (time.Duration, bool) {
+	g.latencyMu.Lock()
+	w := g.latencies[peer]
+	if w == nil || w.n < hedgeMinSamples {
+		g.latencyMu.Unlock()
+		return 0, false
+	}
+	n := w.n
+	if n > hedgeSamples {
+		n = hedgeSamples
+	}
+	samples := append([]time.Duration(nil), w.samples[:n]...)
+	g.latencyMu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[(n*95+99)/100-1], true
+}
+
+// cancelableContext returns a Context that is canceled along with
+// the returned function, if ctx is nil or a context.Context.
+// Otherwise it returns ctx, which cannot be canceled.
+func cancelableContext(ctx Context) (Context, context.CancelFunc) {
+	switch c := ctx.(type) {
+	case nil:
+		return context.WithCancel(context.Background())
+	case context.Context:
+		return context.WithCancel(c)
+	}
+	return ctx, func() {}
+}
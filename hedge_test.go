@@ -0,0 +1,143 @@
+package groupcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// stuckPeer is a peer that answers only once its context is canceled,
+// and then with the context's error.
+type stuckPeer struct {
+	canceled chan struct{}
+}
+
+func (p *stuckPeer) Get(ctx Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	c := ctx.(context.Context)
+	<-c.Done()
+	close(p.canceled)
+	return c.Err()
+}
+
+func TestHedgeToNextPeer(t *testing.T) {
+	slow := &stuckPeer{canceled: make(chan struct{})}
+	fast := new(fakePeer)
+	g := NewGroupOpts("hedge-peer", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		t.Error("loaded locally")
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{
+		Peers:         rankedPeers{slow, fast},
+		PeerFallbacks: 1,
+		HedgeAfter:    10 * time.Millisecond,
+	})
+	defer DeregisterGroup(g.Name())
+
+	var s string
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:k" {
+		t.Errorf("Get = %q; want %q", s, "got:k")
+	}
+	select {
+	case <-slow.canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow peer's request was not canceled")
+	}
+	if got := g.Stats.HedgesIssued.Get(); got != 1 {
+		t.Errorf("HedgesIssued = %d; want 1", got)
+	}
+	if got := g.Stats.HedgesWon.Get(); got != 1 {
+		t.Errorf("HedgesWon = %d; want 1", got)
+	}
+	if got := g.Stats.PeerErrors.Get(); got != 0 {
+		t.Errorf("PeerErrors = %d; want 0 for the abandoned request", got)
+	}
+}
+
+func TestHedgeLocally(t *testing.T) {
+	slow := &stuckPeer{canceled: make(chan struct{})}
+	g := NewGroupOpts("hedge-local", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{Peers: rankedPeers{slow}, HedgeAfter: 10 * time.Millisecond})
+	defer DeregisterGroup(g.Name())
+
+	var s string
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "local:k" {
+		t.Errorf("Get = %q; want %q", s, "local:k")
+	}
+	<-slow.canceled
+	if got := g.Stats.HedgesWon.Get(); got != 1 {
+		t.Errorf("HedgesWon = %d; want 1", got)
+	}
+}
+
+// gatedPeer is a peer that answers once release is closed.
+type gatedPeer struct {
+	release chan struct{}
+}
+
+func (p *gatedPeer) Get(_ Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	<-p.release
+	out.Value = []byte("peer:" + in.GetKey())
+	return nil
+}
+
+func TestHedgeCancelsLocalLoad(t *testing.T) {
+	peer := &gatedPeer{release: make(chan struct{})}
+	started, canceled := make(chan bool), make(chan bool)
+	g := NewGroupOpts("hedge-cancel-local", 1<<20, GetterFunc(func(ctx Context, key string, dest Sink) error {
+		c := ctx.(context.Context)
+		started <- true
+		<-c.Done()
+		canceled <- true
+		return c.Err()
+	}), &GroupOptions{Peers: rankedPeers{peer}, HedgeAfter: time.Millisecond, NegativeCacheTTL: time.Minute})
+	defer DeregisterGroup(g.Name())
+
+	errc := make(chan error, 1)
+	var s string
+	go func() { errc <- g.Get(context.Background(), "k", StringSink(&s)) }()
+	<-started
+	close(peer.release)
+	if err := <-errc; err != nil || s != "peer:k" {
+		t.Fatalf("Get = %q, %v; want %q from the peer", s, err, "peer:k")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("local load was not canceled once the peer answered")
+	}
+	for deadline := time.Now().Add(5 * time.Second); g.Stats.LocalLoadErrs.Get() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("canceled local load did not finish")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if g.mainCache.contains("k") {
+		t.Error("canceled local load was negatively cached")
+	}
+}
+
+func TestPeerP95(t *testing.T) {
+	g := &Group{opts: GroupOptions{HedgeAfter: time.Second, HedgeAtP95: true}}
+	peer := new(fakePeer)
+	for i := 1; i < hedgeMinSamples; i++ {
+		g.recordLatency(peer, time.Duration(i)*time.Millisecond)
+	}
+	if d := g.hedgeDelay(peer); d != time.Second {
+		t.Errorf("hedgeDelay with few samples = %v; want HedgeAfter", d)
+	}
+	for i := hedgeMinSamples; i <= 2*hedgeSamples; i++ {
+		g.recordLatency(peer, time.Duration(i)*time.Millisecond)
+	}
+	// The window holds 101ms to 200ms.
+	if d, want := g.hedgeDelay(peer), 195*time.Millisecond; d != want {
+		t.Errorf("hedgeDelay = %v; want %v", d, want)
+	}
+}
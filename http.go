@@ -18,19 +18,19 @@ package groupcache
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dchest/siphash"
 	"github.com/golang/groupcache/consistenthash"
 	pb "github.com/golang/groupcache/groupcachepb"
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
 )
 
 const defaultBasePath = "/_groupcache/"
@@ -39,6 +39,10 @@ const defaultReplicas = 50
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool struct {
+	// Stats are statistics on the pool. It comes first to be
+	// 8-byte aligned on 32-bit platforms.
+	Stats PoolStats
+
 	// Context optionally specifies a context for the server to use when it
 	// receives a request.
 	// If nil, the server uses a nil Context.
@@ -49,15 +53,51 @@ type HTTPPool struct {
 	// If nil, the client uses http.DefaultTransport.
 	Transport func(Context) http.RoundTripper
 
+	// HealthChanged optionally specifies a function to call when a
+	// peer is removed from the placement for being unhealthy, or
+	// added back once healthy again.
+	HealthChanged func(peer string, healthy bool)
+
 	// this peer's base URL, e.g. "https://example.net:8000"
 	self string
 
 	// opts specifies the options.
 	opts HTTPPoolOptions
 
-	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Multi
+	mu          sync.Mutex // guards members, health, peers, placement, httpGetters and stopHandoff
+	members     []string   // as last passed to Set
+	health      map[string]*peerHealth
+	peers       *consistenthash.Multi  // placement of the healthy members
+	placement   int                    // version of peers, incremented each time it is rebuilt
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+	stopHandoff context.CancelFunc     // cancels the running handoff, if any
+
+	stop chan struct{} // closed to stop health checking
+
+	tlsOnce sync.Once
+	tls     *peerTLS // see peerTLS
+
+	budget retryBudget
+}
+
+// PoolStats are per-pool statistics.
+type PoolStats struct {
+	HandoffKeys     AtomicInt // cached keys found to have moved to another peer
+	HandoffSent     AtomicInt // keys handed off to their new owner
+	HandoffErrors   AtomicInt // keys that failed to be handed off
+	HandoffBytes    AtomicInt // bytes of values handed off
+	HandoffReceived AtomicInt // keys handed off to this peer
+	HandoffsDone    AtomicInt // handoffs that ran to completion
+	HealthChecks    AtomicInt // health checks of peers
+	HealthCheckErrs AtomicInt // health checks that failed
+	PeersEjected    AtomicInt // times a peer was removed for being unhealthy
+	Retries         AtomicInt // requests to peers retried
+	RetriesDenied   AtomicInt // retries not made for lack of budget
+	BreakerTrips    AtomicInt // times a peer's circuit breaker opened
+	BreakerRejects  AtomicInt // requests failed by an open breaker
+
+	CompressedResponses AtomicInt // responses sent to peers compressed
+	CompressionSaved    AtomicInt // bytes saved by compressing responses
 }
 
 // HTTPPoolOptions are the configurations of a HTTPPool.
@@ -73,10 +113,163 @@ type HTTPPoolOptions struct {
 	// HashFn specifies the hash function of the consistent hash.
 	// If blank, it defaults to crc32.ChecksumIEEE.
 	HashFn consistenthash.Hash
+
+	// HandoffBytesPerSecond, if positive, enables handoff: after
+	// Set changes the peers, the values this peer caches for keys
+	// that now belong to another peer are pushed to that peer, at
+	// no more than this many bytes per second. Progress is counted
+	// in Stats.
+	HandoffBytesPerSecond int64
+
+	// HealthCheckInterval, if positive, enables active health
+	// checks: every interval, each peer's health endpoint, at
+	// BasePath + "_health", is requested. A peer failing
+	// UnhealthyThreshold checks in a row is removed from the
+	// placement until a check succeeds again.
+	HealthCheckInterval time.Duration
+
+	// HealthCheckTimeout bounds each health check.
+	// If zero, it defaults to one second.
+	HealthCheckTimeout time.Duration
+
+	// UnhealthyThreshold specifies how many health checks in a row
+	// a peer must fail to be removed. If zero, it defaults to 2.
+	UnhealthyThreshold int
+
+	// OutlierErrors, if positive, enables passive health checks: a
+	// peer whose requests fail this many times in a row is removed
+	// from the placement. It is added back once a health check
+	// succeeds or, without active health checks, after
+	// OutlierEjectFor.
+	OutlierErrors int
+
+	// OutlierEjectFor specifies how long a peer removed for failed
+	// requests stays out when there are no active health checks.
+	// If zero, it defaults to 30 seconds.
+	OutlierEjectFor time.Duration
+
+	// RequestTimeout, if positive, bounds each request to a peer,
+	// including reading its response.
+	RequestTimeout time.Duration
+
+	// Retries specifies how many times a read from a peer that
+	// failed to answer, or answered with a server error, is
+	// retried. Retries back off exponentially from RetryBackoff,
+	// with jitter.
+	Retries int
+
+	// RetryBackoff specifies the delay before the first retry.
+	// If zero, it defaults to 10 milliseconds.
+	RetryBackoff time.Duration
+
+	// RetryBudget caps retries at this fraction of all requests
+	// to peers, over and above a small reserve, so that a peer in
+	// trouble is not buried in retries. If zero, it defaults
+	// to 0.1.
+	RetryBudget float64
+
+	// BreakerErrorRate, if positive, enables a circuit breaker for
+	// each peer: once at least this fraction of the peer's last
+	// BreakerWindow requests have failed, requests to it fail at
+	// once, so that its keys are loaded elsewhere, for
+	// BreakerOpenFor. A single trial request then decides whether
+	// the breaker closes again or stays open.
+	BreakerErrorRate float64
+
+	// BreakerWindow specifies how many recent requests the error
+	// rate is measured over. If zero, it defaults to 20.
+	BreakerWindow int
+
+	// BreakerSlowAfter, if positive, makes requests taking longer
+	// than this count as failures for the circuit breaker.
+	BreakerSlowAfter time.Duration
+
+	// BreakerOpenFor specifies how long an open breaker fails
+	// requests before letting a trial through. If zero, it
+	// defaults to five seconds.
+	BreakerOpenFor time.Duration
+
+	// TLSCertFile and TLSKeyFile, if set, name the PEM files of the
+	// certificate and key this peer presents, both when serving its
+	// peers with ServerTLSConfig and, as a client certificate, when
+	// making requests to them. The files are reread soon after they
+	// change, so that certificates can be rotated without a restart.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSCAFile, if set, names a PEM file of the certificates that
+	// peers' certificates must be signed by. If empty, the system's
+	// roots are used. Like TLSCertFile, it is reread when changed.
+	//
+	// When any TLS option is set and Transport is nil, requests to
+	// peers, whose URLs should then be https, verify that the peer
+	// presents a certificate for its host.
+	TLSCAFile string
+
+	// TLSRequireClientCert makes ServerTLSConfig require mutual TLS:
+	// peers must present a client certificate signed by TLSCAFile
+	// and valid for the host of one of the peers passed to Set.
+	TLSRequireClientCert bool
+
+	// Auth, if non-nil, authenticates requests between peers: those
+	// the pool sends are signed with it, and those it serves, bar
+	// health checks, are refused with 401 Unauthorized unless they
+	// verify. HMACAuth and BearerAuth are provided.
+	Auth Authenticator
+
+	// Authorize, if non-nil, decides whether the authenticated
+	// identity may read keys of group or, if write is set, store
+	// values into it, as a Save or handoff does. Refused requests
+	// get 403 Forbidden. It applies only along with Auth.
+	Authorize func(identity, group string, write bool) bool
+
+	// Compression lists the compressions, of "zstd", "snappy" and
+	// "gzip", that the pool uses in order of preference. Requests
+	// to peers ask for responses compressed with them, and
+	// responses are compressed with the first of them that the
+	// requesting peer asks for. Peers configured differently still
+	// interoperate, falling back to uncompressed responses.
+	Compression []string
+
+	// CompressMinBytes specifies the size below which responses
+	// are not compressed. If zero, it defaults to 1024.
+	CompressMinBytes int
+
+	// MaxValueBytes, if positive, caps the size of values fetched
+	// from peers: larger ones fail to load, without being read or
+	// decompressed into memory in full.
+	MaxValueBytes int64
+
+	// TracePropagator, if non-nil, carries the trace context of the
+	// Gets that fetch from peers in the headers of the requests to
+	// them, and into the Context of the Gets serving those requests.
+	TracePropagator TracePropagator
+
+	// Logger, if non-nil, receives the pool's log messages at
+	// LogLevel and above. By default nothing is logged.
+	Logger   Logger
+	LogLevel LogLevel
+
+	// LogValues makes log messages carry values in full; by default
+	// only their size is logged.
+	LogValues bool
+
+	// MaxKeyBytes bounds the length of the group names and keys of
+	// requests the pool serves; longer ones are refused with 414
+	// Request-URI Too Long. If zero, it defaults to 4096.
+	MaxKeyBytes int
+
+	// MaxBodyBytes bounds the size of the values that requests the
+	// pool serves may save or hand off; larger ones are refused
+	// with 413 Request Entity Too Large. If zero, it defaults to
+	// 64 MiB.
+	MaxBodyBytes int64
 }
 
-// NewHTTPPool initializes an HTTP pool of peers, and registers itself as a PeerPicker.
-// For convenience, it also registers itself as an http.Handler with http.DefaultServeMux.
+// NewHTTPPool initializes an HTTP pool of peers, and registers itself as a PeerPicker
+// unless one is registered already.
+// For convenience, it also registers itself as an http.Handler with http.DefaultServeMux,
+// so it may be called only once; use NewHTTPPoolOpts for further pools.
 // The self argument should be a valid base URL that points to the current server,
 // for example "http://example.net:8000".
 func NewHTTPPool(self string) *HTTPPool {
@@ -85,19 +278,17 @@ func NewHTTPPool(self string) *HTTPPool {
 	return p
 }
 
-var httpPoolMade bool
-
 func siphash64seed(b []byte, s uint64) uint64 { return siphash.Hash(s, 0, b) }
 
 // NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
 // Unlike NewHTTPPool, this function does not register the created pool as an HTTP handler.
 // The returned *HTTPPool implements http.Handler and must be registered using http.Handle.
+//
+// Several pools may be made, for instance to join several clusters. The first
+// is registered as the PeerPicker of groups created without GroupOptions.Peers;
+// the others serve and find peers only for the groups bound to them with
+// GroupOptions.Peers.
 func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
-	if httpPoolMade {
-		panic("groupcache: NewHTTPPool must be called only once")
-	}
-	httpPoolMade = true
-
 	p := &HTTPPool{
 		self:        self,
 		httpGetters: make(map[string]*httpGetter),
@@ -111,25 +302,81 @@ func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
 	if p.opts.Replicas == 0 {
 		p.opts.Replicas = defaultReplicas
 	}
+	for _, name := range p.opts.Compression {
+		lookupCodec(name)
+	}
 	//p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
 	p.peers = consistenthash.NewmpcHash(p.opts.Replicas, 1, siphash64seed, [2]uint64{1, 2}, 21)
+	if p.opts.HealthCheckInterval > 0 || p.opts.OutlierErrors > 0 {
+		p.stop = make(chan struct{})
+		go p.healthLoop(p.stop)
+	}
 
-	RegisterPeerPicker(func() PeerPicker { return p })
+	registerDefaultPeerPicker(func() PeerPicker { return p })
 	return p
 }
 
+// Close stops the pool's background work, such as health checks and
+// handoffs.
+func (p *HTTPPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopHandoff != nil {
+		p.stopHandoff()
+		p.stopHandoff = nil
+	}
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
 // Set updates the pool's list of peers.
 // Each peer value should be a valid base URL,
 // for example "http://example.net:8000".
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.peers = consistenthash.NewmpcHash(6000, 1, siphash64seed, [2]uint64{1, 2}, 21)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	old := p.peers
+	p.members = append([]string(nil), peers...)
+	health := make(map[string]*peerHealth, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{transport: p.Transport, baseURL: peer + p.opts.BasePath}
+		if h, ok := p.health[peer]; ok {
+			health[peer] = h
+		}
 	}
+	p.health = health
+	p.placeLocked()
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, peer := range peers {
+		h := &httpGetter{transport: p.Transport, baseURL: peer + p.opts.BasePath, pool: p, peer: peer, hello: new(peerHello)}
+		if old := p.httpGetters[peer]; old != nil && old.hello != nil {
+			h.hello = old.hello
+		}
+		if p.opts.BreakerErrorRate > 0 {
+			if old := p.httpGetters[peer]; old != nil && old.breaker != nil {
+				h.breaker = old.breaker
+			} else {
+				h.breaker = new(breaker)
+			}
+		}
+		getters[peer] = h
+	}
+	p.httpGetters = getters
+	if p.stopHandoff != nil {
+		p.stopHandoff()
+		p.stopHandoff = nil
+	}
+	if p.opts.HandoffBytesPerSecond > 0 && old != nil && !old.IsEmpty() && !p.peers.IsEmpty() {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.stopHandoff = cancel
+		go p.handoff(ctx, old, p.peers, p.httpGetters)
+	}
+	live := make([]ProtoGetter, 0, len(getters))
+	for _, h := range getters {
+		live = append(live, h)
+	}
+	p.mu.Unlock()
+	forgetPeers(p, live)
 }
 
 func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
@@ -138,115 +385,329 @@ func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
 	if p.peers.IsEmpty() {
 		return nil, false
 	}
-	temp_peer := p.peers.Hash(key)
-	log.Println("peer picked ::::::::=", temp_peer[0])
-	log.Println("p.self:::::::::=", p.self)
-	log.Println("peer[0] != p.self", temp_peer[0] != p.self)
 	if peer := p.peers.Hash(key); peer[0] != p.self {
+		if l := p.logger(); l.enabled(LogDebug) {
+			l.log(LogDebug, "picked peer", LogField{"key", key}, LogField{"peer", peer[0]})
+		}
 		return p.httpGetters[peer[0]], true
 	}
 	return nil, false
 }
 
+func (p *HTTPPool) PickN(key string, n int) []ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil
+	}
+	var peers []ProtoGetter
+	for _, peer := range p.peers.HashN(key, n) {
+		if peer == p.self {
+			break
+		}
+		peers = append(peers, p.httpGetters[peer])
+	}
+	return peers
+}
+
 //////overnest
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Println("sever http..........000")
 	// Parse request.
 	if !strings.HasPrefix(r.URL.Path, p.opts.BasePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		httpError(w, http.StatusNotFound, "bad_path", "not a groupcache path: "+r.URL.Path)
+		return
 	}
-	parts := strings.SplitN(r.URL.Path[len(p.opts.BasePath):], "/", 2)
-	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if r.URL.Path == p.opts.BasePath+healthPath {
+		if allowMethods(w, r, "GET", "HEAD") {
+			io.WriteString(w, "ok\n")
+		}
+		return
+	}
+	switch r.URL.Path {
+	case p.opts.BasePath + breakersPath:
+		if !allowMethods(w, r, "GET") {
+			return
+		}
+	case p.opts.BasePath + helloPath:
+		if !allowMethods(w, r, "POST") {
+			return
+		}
+	default:
+		if !allowMethods(w, r, "GET", "POST", "PUT") {
+			return
+		}
+	}
+	if !p.preauthenticate(w, r) {
+		return
+	}
+	body, ok := p.readBody(w, r)
+	if !ok {
+		return
+	}
+	identity, ok := p.authenticate(w, r, body)
+	if !ok {
+		return
+	}
+	switch r.URL.Path {
+	case p.opts.BasePath + breakersPath:
+		p.serveBreakers(w, r)
+		return
+	case p.opts.BasePath + helloPath:
+		p.serveHello(w, body)
+		return
+	}
+	groupName, key, err := parsePath(p.opts.BasePath, r.URL.EscapedPath())
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "bad_path", err.Error())
+		return
+	}
+	if max := p.maxKeyBytes(); len(groupName) > max || len(key) > max {
+		httpError(w, http.StatusRequestURITooLong, "key_too_long", fmt.Sprintf("group and key may be at most %d bytes", max))
 		return
 	}
-	groupName := parts[0]
-	key := parts[1]
 
 	// Fetch the value for this group/key.
-	group := GetGroup(groupName)
+	group := p.group(groupName)
 	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		httpError(w, http.StatusNotFound, "no_such_group", "no such group: "+groupName)
 		return
 	}
 	var ctx Context
 	if p.Context != nil {
 		ctx = p.Context(r)
 	}
+	ctx = p.extractTrace(ctx, r)
+
+	switch {
+	case r.Method == "PUT":
+		if p.authorize(w, identity, groupName, true) {
+			p.receiveHandoff(w, group, key, body)
+		}
+		return
+	case r.Method == "GET" && len(body) > 0:
+		httpError(w, http.StatusBadRequest, "unexpected_body", "a GET carries no value; save values with POST")
+		return
+	case r.Method == "POST" && len(body) == 0:
+		httpError(w, http.StatusBadRequest, "missing_value", "a POST carries the value to save")
+		return
+	}
+	if !p.authorize(w, identity, groupName, r.Method == "POST") {
+		return
+	}
+	if l := p.logger(); l.enabled(LogDebug) {
+		fields := []LogField{{"group", groupName}, {"key", key}, {"method", r.Method}}
+		if len(body) > 0 {
+			fields = append(fields, l.value(body))
+		}
+		l.log(LogDebug, "serving peer", fields...)
+	}
 
-	group.Stats.ServerRequests.Add(1)
-	var value []byte
-	dest := AllocatingByteSliceSink(&value)
-	value, err := ioutil.ReadAll(r.Body)
-	dest.SetBytes(value)
-	log.Println("sever http..........")
-	log.Println(dest.View())
+	res := group.servePeer(ctx, key, body)
 
-	group.Get(ctx, key, dest)
+	if r.Header.Get("Accept") == streamContentType {
+		writeStream(w, res)
+		return
+	}
 
 	// Write the value to the response body as a proto message.
-	body, err := proto.Marshal(&pb.GetResponse{Value: value})
+	respBody, err := proto.Marshal(res)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, http.StatusInternalServerError, "internal", err.Error())
 		return
 	}
+	respBody, encoding := p.compressResponse(r.Header.Get("Accept-Encoding"), respBody)
 	w.Header().Set("Content-Type", "application/x-protobuf")
-	w.Write(body)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Write(respBody)
 }
 
 type httpGetter struct {
 	transport func(Context) http.RoundTripper
 	baseURL   string
+
+	// pool, if non-nil, is told how requests to peer fare.
+	pool *HTTPPool
+	peer string
+
+	breaker *breaker   // nil unless the pool has circuit breakers
+	hello   *peerHello // nil unless made by a pool
 }
 
 var bufferPool = sync.Pool{
 	New: func() interface{} { return new(bytes.Buffer) },
 }
 
-func check(e error) {
-	if e != nil {
-		panic(e)
+// group returns the named group, unless it is bound to another
+// pool, which alone serves it.
+func (p *HTTPPool) group(name string) *Group {
+	return servedGroup(name, p)
+}
+
+// servedGroup returns the named group if pool may serve it: groups
+// bound to an HTTPPool or GRPCPool are served by that pool only.
+func servedGroup(name string, pool PeerPicker) *Group {
+	g := GetGroup(name)
+	if g == nil {
+		return nil
+	}
+	g.peersOnce.Do(g.initPeers)
+	switch g.peers.(type) {
+	case *HTTPPool, *GRPCPool:
+		if g.peers != pool {
+			return nil
+		}
 	}
+	return g
 }
 
-func (h *httpGetter) Get(context Context, in *pb.GetRequest, out *pb.GetResponse) error {
-	log.Println("context=====555", context)
-	u := fmt.Sprintf(
+// url returns the URL of key in group on h's peer.
+func (h *httpGetter) url(group, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
-	log.Println("u=====666", in.GetValue())
-
-	req, err := http.NewRequest("GET", u, ioutil.NopCloser(bytes.NewBuffer(in.GetValue())))
-	check(err)
-	log.Println("u=====777 after NewRequest")
+}
 
-	tr := http.DefaultTransport
+func (h *httpGetter) roundTripper(context Context) http.RoundTripper {
 	if h.transport != nil {
-		log.Println("context=====666", context)
-		tr = h.transport(context)
+		return h.transport(context)
+	}
+	if h.pool != nil && h.pool.usesTLS() {
+		return h.pool.peerTLS().transport
 	}
+	return http.DefaultTransport
+}
 
-	res, err := tr.RoundTrip(req)
-	if err != nil {
-		return err
+// withContext returns req bound to ctx if ctx is a context.Context,
+// so that canceling ctx abandons the request.
+func withContext(req *http.Request, ctx Context) *http.Request {
+	if c, ok := ctx.(context.Context); ok {
+		return req.WithContext(c)
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+	return req
+}
+
+func (h *httpGetter) Get(context Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	// Only reads are retried; a request carrying a value saves it.
+	idempotent := len(in.GetValue()) == 0
+	h.fundRetries()
+	for attempt := 0; ; attempt++ {
+		retry, err := h.get(context, in, out)
+		if err == nil || !retry || !idempotent || !h.retryAllowed(attempt) {
+			return err
+		}
+		if !sleepContext(context, h.backoff(attempt)) {
+			return err
+		}
+		h.logger().log(LogDebug, "retrying peer", LogField{"peer", h.String()}, LogField{"key", in.GetKey()}, LogField{"error", err})
 	}
+}
+
+// get makes one request for in, and reports whether it is worth
+// retrying if it fails.
+func (h *httpGetter) get(ctx Context, in *pb.GetRequest, out *pb.GetResponse) (retry bool, err error) {
+	return h.roundTrip(ctx, in, false, func(res *http.Response) (bool, error) {
+		return h.readResponse(ctx, res, out)
+	})
+}
+
+// readResponse reads into out the response res to a request that did
+// not ask for streaming, and reports whether a failure is worth
+// retrying.
+func (h *httpGetter) readResponse(ctx Context, res *http.Response, out *pb.GetResponse) (retry bool, err error) {
 	b := bufferPool.Get().(*bytes.Buffer)
 	b.Reset()
 	defer bufferPool.Put(b)
-	_, err = io.Copy(b, res.Body)
+	max := h.maxValueBytes()
+	var limit int64 // of the response body, compressed or not
+	var body io.Reader = res.Body
+	if max > 0 {
+		limit = max + maxResponseOverhead
+		body = io.LimitReader(body, limit+1)
+	}
+	n, err := io.Copy(b, body)
+	if err != nil {
+		return !abandoned(ctx), fmt.Errorf("reading response body: %v", err)
+	}
+	if limit > 0 && n > limit {
+		return false, errValueTooLarge
+	}
+	data, err := decompressResponse(res.Header.Get("Content-Encoding"), b.Bytes(), limit)
+	if err == errValueTooLarge {
+		return false, err
+	}
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return false, fmt.Errorf("decompressing response body: %v", err)
 	}
-	err = proto.Unmarshal(b.Bytes(), out)
+	err = proto.Unmarshal(data, out)
 	if err != nil {
-		return fmt.Errorf("decoding response body: %v", err)
+		return false, fmt.Errorf("decoding response body: %v", err)
+	}
+	if max > 0 && int64(len(out.Value)) > max {
+		out.Value = nil
+		return false, errValueTooLarge
+	}
+	return false, nil
+}
+
+// roundTrip makes one request for in, asking for a streamed response
+// if stream is set, and passes a successful response to read. It
+// reports whether a failure is worth retrying.
+func (h *httpGetter) roundTrip(ctx Context, in *pb.GetRequest, stream bool, read func(*http.Response) (retry bool, err error)) (retry bool, err error) {
+	u := h.url(in.GetGroup(), in.GetKey())
+
+	// A request carrying a value saves it.
+	method, body := "GET", io.Reader(nil)
+	if len(in.GetValue()) > 0 {
+		method, body = "POST", bytes.NewReader(in.GetValue())
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return false, err
+	}
+	if stream {
+		req.Header.Set("Accept", streamContentType)
+	} else if h.pool != nil && len(h.pool.opts.Compression) > 0 && supports(ctx, h, pb.Capability_CAP_COMPRESSION) {
+		req.Header.Set("Accept-Encoding", h.pool.acceptEncoding())
+	}
+	h.injectTrace(ctx, req)
+	if err := h.sign(req, in.GetValue()); err != nil {
+		return false, err
+	}
+	req = withContext(req, ctx)
+	if h.pool != nil && h.pool.opts.RequestTimeout > 0 {
+		c, cancel := context.WithTimeout(req.Context(), h.pool.opts.RequestTimeout)
+		defer cancel()
+		req = req.WithContext(c)
+	}
+
+	if !h.breakerAllow() {
+		return false, errBreakerOpen
+	}
+	start := time.Now()
+	res, err := h.roundTripper(ctx).RoundTrip(req)
+	if err != nil {
+		if abandoned(ctx) {
+			h.breakerAbandon()
+			return false, err
+		}
+		h.requestFailed()
+		h.breakerRecord(true, time.Since(start))
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 500 {
+		h.requestFailed()
+	} else {
+		h.requestSucceeded()
+	}
+	h.breakerRecord(res.StatusCode >= 500, time.Since(start))
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode >= 500, statusError(res)
 	}
-	return nil
+	return read(res)
 }
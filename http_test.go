@@ -22,6 +22,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"strconv"
@@ -29,6 +30,9 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -164,3 +168,55 @@ func awaitAddrReady(t *testing.T, addr string, wg *sync.WaitGroup) {
 		time.Sleep(delay)
 	}
 }
+
+func TestServeHTTPNegativeCaching(t *testing.T) {
+	getter := GetterFunc(func(ctx Context, key string, dest Sink) error {
+		return ErrNotFound
+	})
+	p := NewHTTPPoolOpts("http://self", nil)
+	NewGroupOpts("httpNegativeTest", 1<<20, getter, &GroupOptions{Peers: p, NegativeCacheTTL: time.Minute})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", defaultBasePath+"httpNegativeTest/absent", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	res := new(pb.GetResponse)
+	if err := proto.Unmarshal(rec.Body.Bytes(), res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.GetNotFound() || res.GetError() != ErrNotFound.Error() || res.GetTtlMs() <= 0 {
+		t.Errorf("response = %v; want a not-found error with a TTL", res)
+	}
+}
+
+func TestMultiplePools(t *testing.T) {
+	p1 := NewHTTPPoolOpts("http://cluster1", nil)
+	p2 := NewHTTPPoolOpts("http://cluster2", nil)
+	getter := func(cluster string) Getter {
+		return GetterFunc(func(ctx Context, key string, dest Sink) error {
+			return dest.SetString(cluster + ":" + key)
+		})
+	}
+	g1 := NewGroupOpts("multiPoolTest1", 1<<20, getter("1"), &GroupOptions{Peers: p1})
+	defer DeregisterGroup(g1.Name())
+	g2 := NewGroupOpts("multiPoolTest2", 1<<20, getter("2"), &GroupOptions{Peers: p2})
+	defer DeregisterGroup(g2.Name())
+
+	for _, tt := range []struct {
+		p     *HTTPPool
+		group string
+		code  int
+	}{
+		{p1, g1.Name(), http.StatusOK},
+		{p1, g2.Name(), http.StatusNotFound},
+		{p2, g2.Name(), http.StatusOK},
+		{p2, g1.Name(), http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		tt.p.ServeHTTP(rec, httptest.NewRequest("GET", defaultBasePath+tt.group+"/k", nil))
+		if rec.Code != tt.code {
+			t.Errorf("pool %s serving %s: status = %d; want %d", tt.p.self, tt.group, rec.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// logger.go lets groups and pools report what they do, such as failed
+// peer fetches, to a structured Logger. Nothing is logged unless a
+// Logger is set, and cached values are redacted unless asked for.
+
+package groupcache
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A LogLevel is the severity of a log message.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota - 1
+	LogInfo           // the zero LogLevel
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// A LogField is a named value attached to a log message, such as the
+// group, key or peer it is about.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// A Logger receives the log messages of groups and pools, set with
+// GroupOptions.Logger and HTTPPoolOptions.Logger. It must be safe for
+// concurrent use. Adapting it to a structured logging library means
+// passing each field as an attribute of the message.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// StdLogger returns a Logger writing each message to l as one line of
+// key=value pairs. A nil l writes to standard error.
+func StdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return stdLogger{l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s stdLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "groupcache: level=%s msg=%s", level, logfmtValue(msg))
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%s", f.Key, logfmtValue(fmt.Sprint(f.Value)))
+	}
+	s.l.Output(3, b.String()) // reporting the caller of logConfig.log
+}
+
+// logfmtValue quotes s if it would otherwise not read back as one
+// value.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// logConfig is how a group or pool logs.
+type logConfig struct {
+	logger Logger
+	level  LogLevel
+	values bool // whether values are logged in full
+}
+
+// enabled reports whether messages at level are logged. Callers on hot
+// paths check it before building fields.
+func (c logConfig) enabled(level LogLevel) bool {
+	return c.logger != nil && level >= c.level
+}
+
+func (c logConfig) log(level LogLevel, msg string, fields ...LogField) {
+	if c.enabled(level) {
+		c.logger.Log(level, msg, fields...)
+	}
+}
+
+// value returns the field logging b, a cached value, which is
+// redacted to its size unless values are logged in full.
+func (c logConfig) value(b []byte) LogField {
+	if c.values {
+		return LogField{"value", string(b)}
+	}
+	return LogField{"value", fmt.Sprintf("<redacted %d bytes>", len(b))}
+}
+
+func (g *Group) logger() logConfig {
+	return logConfig{g.opts.Logger, g.opts.LogLevel, g.opts.LogValues}
+}
+
+func (p *HTTPPool) logger() logConfig {
+	return logConfig{p.opts.Logger, p.opts.LogLevel, p.opts.LogValues}
+}
+
+// logger returns the logging of the getter's pool, if any.
+func (h *httpGetter) logger() logConfig {
+	if h.pool == nil {
+		return logConfig{}
+	}
+	return h.pool.logger()
+}
@@ -0,0 +1,92 @@
+package groupcache
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger records the messages it is given.
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprint(level, " ", msg, fields))
+}
+
+func TestGroupLogger(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		level LogLevel
+		want  int
+	}{
+		{"warn", LogWarn, 1},
+		{"error", LogError, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &recordingLogger{}
+			g := NewGroupOpts("TestGroupLogger-"+tt.name, 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+				return dest.SetString("local")
+			}), &GroupOptions{Peers: fakePeers([]ProtoGetter{&fakePeer{fail: true}}), Logger: l, LogLevel: tt.level})
+			defer DeregisterGroup(g.Name())
+
+			var s string
+			if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+				t.Fatal(err)
+			}
+			if len(l.msgs) != tt.want {
+				t.Fatalf("logged %q; want %d messages", l.msgs, tt.want)
+			}
+			if tt.want > 0 && (!strings.HasPrefix(l.msgs[0], "warn peer fetch failed") || !strings.Contains(l.msgs[0], "simulated error")) {
+				t.Errorf("logged %q; want the peer's failure", l.msgs[0])
+			}
+		})
+	}
+}
+
+func TestPoolLogger(t *testing.T) {
+	l := &recordingLogger{}
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, Logger: l, LogLevel: LogDebug}}
+	p.Set("http://self", "http://other")
+	var picked string
+	for i := 0; picked == "" && i < 100; i++ {
+		if _, ok := p.PickPeer(fmt.Sprint("key", i)); ok {
+			picked = fmt.Sprint("key", i)
+		}
+	}
+	if len(l.msgs) != 1 || !strings.Contains(l.msgs[0], "picked peer") || !strings.Contains(l.msgs[0], picked) {
+		t.Errorf("logged %q; want the pick of %q", l.msgs, picked)
+	}
+
+	p.opts.LogLevel = LogInfo
+	p.PickPeer(picked)
+	if len(l.msgs) != 1 {
+		t.Errorf("logged %q at LogInfo; want no debug messages", l.msgs[1:])
+	}
+}
+
+func TestLogValueRedacted(t *testing.T) {
+	value := []byte("secret")
+	if f := (logConfig{}).value(value); f.Value != "<redacted 6 bytes>" {
+		t.Errorf("value logged as %v; want it redacted", f.Value)
+	}
+	if f := (logConfig{values: true}).value(value); f.Value != "secret" {
+		t.Errorf("value logged as %v with LogValues; want it in full", f.Value)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	StdLogger(log.New(&buf, "", 0)).Log(LogWarn, "peer fetch failed", LogField{"key", "a b"}, LogField{"peer", "http://peer"})
+	want := `groupcache: level=warn msg="peer fetch failed" key="a b" peer=http://peer` + "\n"
+	if buf.String() != want {
+		t.Errorf("StdLogger wrote %q; want %q", buf.String(), want)
+	}
+}
@@ -82,6 +82,16 @@ func (c *Cache) Get(key Key) (value interface{}, ok bool) {
 	return
 }
 
+// Contains reports whether key is in the cache, without updating
+// its recent use.
+func (c *Cache) Contains(key Key) bool {
+	if c.cache == nil {
+		return false
+	}
+	_, hit := c.cache[key]
+	return hit
+}
+
 // Remove removes the provided key from the cache.
 func (c *Cache) Remove(key Key) {
 	if c.cache == nil {
@@ -112,6 +122,21 @@ func (c *Cache) removeElement(e *list.Element) {
 	}
 }
 
+// Range calls f for each item in the cache, from the least to the most
+// recently used, until f returns false. It does not update the
+// recency of the items, and f must not modify the cache.
+func (c *Cache) Range(f func(key Key, value interface{}) bool) {
+	if c.cache == nil {
+		return
+	}
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		kv := e.Value.(*entry)
+		if !f(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
 // Len returns the number of items in the cache.
 func (c *Cache) Len() int {
 	if c.cache == nil {
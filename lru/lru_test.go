@@ -95,3 +95,36 @@ func TestEvict(t *testing.T) {
 		t.Fatalf("got %v in second evicted key; want %s", evictedKeys[1], "myKey1")
 	}
 }
+
+func TestContains(t *testing.T) {
+	lru := New(2)
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	if !lru.Contains("a") || lru.Contains("c") {
+		t.Fatal("Contains reported the wrong keys")
+	}
+	// Contains must not count as a use, so "a" is still the oldest.
+	lru.Add("c", 3)
+	if lru.Contains("a") {
+		t.Fatal("Contains refreshed the recency of its key")
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(0)
+	for i := 0; i < 3; i++ {
+		lru.Add(i, i*10)
+	}
+	lru.Get(0)
+	var keys []Key
+	lru.Range(func(key Key, value interface{}) bool {
+		if value != key.(int)*10 {
+			t.Errorf("Range(%v) value = %v", key, value)
+		}
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if fmt.Sprint(keys) != "[1 2]" {
+		t.Errorf("Range visited %v; want [1 2]", keys)
+	}
+}
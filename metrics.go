@@ -0,0 +1,259 @@
+// metrics.go exports the Stats and CacheStats of every group, along
+// with histograms of how long loads take, in the Prometheus text
+// format and through expvar, without depending on a metrics library.
+
+package groupcache
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// latencyBuckets are the upper bounds of the buckets of latency
+// histograms.
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// A histogram counts durations by bucket of latencyBuckets.
+type histogram struct {
+	// counts holds the count of each bucket, then of durations
+	// beyond the last, then the sum of all durations in
+	// nanoseconds. Being allocated apart, it is 8-byte aligned.
+	counts []AtomicInt
+}
+
+func newHistogram() histogram {
+	return histogram{counts: make([]AtomicInt, len(latencyBuckets)+2)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		return // a Group not made by NewGroup
+	}
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	h.counts[i].Add(1)
+	h.counts[len(h.counts)-1].Add(int64(d))
+}
+
+// A HistogramSnapshot is the state of a latency histogram.
+type HistogramSnapshot struct {
+	// Buckets holds, for the upper bound of each bucket in seconds,
+	// the count of durations no longer than it. The last bound
+	// is "+Inf".
+	Buckets []Bucket
+	Count   int64
+	Sum     float64 // in seconds
+}
+
+// A Bucket is a bucket of a HistogramSnapshot.
+type Bucket struct {
+	UpperBound string // in seconds, or "+Inf"
+	Count      int64  // cumulative
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	var s HistogramSnapshot
+	if h.counts == nil {
+		return s
+	}
+	for i := 0; i <= len(latencyBuckets); i++ {
+		s.Count += h.counts[i].Get()
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = strconv.FormatFloat(latencyBuckets[i].Seconds(), 'g', -1, 64)
+		}
+		s.Buckets = append(s.Buckets, Bucket{UpperBound: le, Count: s.Count})
+	}
+	s.Sum = time.Duration(h.counts[len(h.counts)-1].Get()).Seconds()
+	return s
+}
+
+// LocalLoadLatency returns the histogram of how long the group's
+// Getter takes to load keys.
+func (g *Group) LocalLoadLatency() HistogramSnapshot { return g.localLatency.snapshot() }
+
+// PeerFetchLatency returns the histogram of how long fetching keys
+// from peers takes, failed fetches included.
+func (g *Group) PeerFetchLatency() HistogramSnapshot { return g.peerLatency.snapshot() }
+
+// statsMap returns the counters of s, a pointer to a struct of
+// AtomicInts such as Stats or PoolStats, keyed by field name.
+func statsMap(s interface{}) map[string]int64 {
+	v := reflect.ValueOf(s).Elem()
+	m := make(map[string]int64, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		if n, ok := v.Field(i).Addr().Interface().(*AtomicInt); ok {
+			m[v.Type().Field(i).Name] = n.Get()
+		}
+	}
+	return m
+}
+
+// sortedGroups returns the registered groups, sorted by name.
+func sortedGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	return gs
+}
+
+// cacheMetrics are the Prometheus metrics of the fields of
+// CacheStats.
+var cacheMetrics = []struct {
+	name, typ string
+	value     func(CacheStats) int64
+}{
+	{"groupcache_cache_bytes", "gauge", func(s CacheStats) int64 { return s.Bytes }},
+	{"groupcache_cache_items", "gauge", func(s CacheStats) int64 { return s.Items }},
+	{"groupcache_cache_gets_total", "counter", func(s CacheStats) int64 { return s.Gets }},
+	{"groupcache_cache_hits_total", "counter", func(s CacheStats) int64 { return s.Hits }},
+	{"groupcache_cache_evictions_total", "counter", func(s CacheStats) int64 { return s.Evictions }},
+	{"groupcache_cache_saved_bytes", "gauge", func(s CacheStats) int64 { return s.Saved }},
+}
+
+// WritePrometheus writes the metrics of all groups to w in the
+// Prometheus text exposition format: a counter for each field of
+// Stats, named groupcache_group_*, and a metric for each of
+// CacheStats, named groupcache_cache_*, labeled with the group and,
+// for the latter, the cache, and histograms of the durations of local
+// loads and of fetches from peers.
+func WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	gs := sortedGroups()
+	stats := make([]map[string]int64, len(gs))
+	for i, g := range gs {
+		stats[i] = statsMap(&g.Stats)
+	}
+
+	st := reflect.TypeOf(Stats{})
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i).Name
+		name := "groupcache_group_" + snakeCase(field) + "_total"
+		fmt.Fprintf(bw, "# TYPE %s counter\n", name)
+		for j, g := range gs {
+			fmt.Fprintf(bw, "%s{group=%s} %d\n", name, labelValue(g.name), stats[j][field])
+		}
+	}
+
+	caches := []struct {
+		label string
+		which CacheType
+	}{{"main", MainCache}, {"hot", HotCache}}
+	for _, m := range cacheMetrics {
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		for _, g := range gs {
+			for _, c := range caches {
+				fmt.Fprintf(bw, "%s{group=%s,cache=%q} %d\n", m.name, labelValue(g.name), c.label, m.value(g.CacheStats(c.which)))
+			}
+		}
+	}
+
+	for _, h := range []struct {
+		name string
+		get  func(*Group) HistogramSnapshot
+	}{
+		{"groupcache_local_load_duration_seconds", (*Group).LocalLoadLatency},
+		{"groupcache_peer_fetch_duration_seconds", (*Group).PeerFetchLatency},
+	} {
+		fmt.Fprintf(bw, "# TYPE %s histogram\n", h.name)
+		for _, g := range gs {
+			s := h.get(g)
+			group := labelValue(g.name)
+			for _, b := range s.Buckets {
+				fmt.Fprintf(bw, "%s_bucket{group=%s,le=%q} %d\n", h.name, group, b.UpperBound, b.Count)
+			}
+			fmt.Fprintf(bw, "%s_sum{group=%s} %s\n", h.name, group, strconv.FormatFloat(s.Sum, 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{group=%s} %d\n", h.name, group, s.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// PrometheusHandler returns a handler serving WritePrometheus. It is
+// not registered by the package; register it, for instance, at
+// "/metrics".
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w)
+	})
+}
+
+// snakeCase turns a field name such as "LocalLoadErrs" into a metric
+// name such as "local_load_errs".
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// labelValue quotes s as the value of a Prometheus label.
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// groupMetrics are the metrics of a group published through expvar.
+type groupMetrics struct {
+	Stats            map[string]int64
+	MainCache        CacheStats
+	HotCache         CacheStats
+	LocalLoadLatency HistogramSnapshot
+	PeerFetchLatency HistogramSnapshot
+}
+
+// PublishExpvar publishes the metrics of all groups as the expvar
+// variable name: a map from each group's name to its Stats, the
+// CacheStats of its main and hot caches, and its latency histograms.
+// Like expvar.Publish, it panics if name is already published.
+func PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		m := make(map[string]groupMetrics)
+		for _, g := range sortedGroups() {
+			m[g.name] = groupMetrics{
+				Stats:            statsMap(&g.Stats),
+				MainCache:        g.CacheStats(MainCache),
+				HotCache:         g.CacheStats(HotCache),
+				LocalLoadLatency: g.LocalLoadLatency(),
+				PeerFetchLatency: g.PeerFetchLatency(),
+			}
+		}
+		return m
+	}))
+}
@@ -0,0 +1,119 @@
+package groupcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram()
+	for _, d := range []time.Duration{50 * time.Microsecond, time.Millisecond, 3 * time.Millisecond, time.Minute} {
+		h.observe(d)
+	}
+	s := h.snapshot()
+	if s.Count != 4 || s.Sum < 60 {
+		t.Errorf("count %d, sum %v; want 4 and over 60s", s.Count, s.Sum)
+	}
+	want := map[string]int64{"0.0001": 1, "0.001": 2, "0.0025": 2, "0.005": 3, "10": 3, "+Inf": 4}
+	for _, b := range s.Buckets {
+		if n, ok := want[b.UpperBound]; ok && b.Count != n {
+			t.Errorf("bucket le=%s counts %d; want %d", b.UpperBound, b.Count, n)
+		}
+	}
+	if last := s.Buckets[len(s.Buckets)-1]; last.UpperBound != "+Inf" {
+		t.Errorf("last bucket is le=%s; want +Inf", last.UpperBound)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	g := NewGroupOpts("TestWritePrometheus-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: fakePeers(nil)})
+	defer DeregisterGroup(g.Name())
+	for i := 0; i < 3; i++ {
+		var s string
+		if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	group := `group="TestWritePrometheus-group"`
+	for _, line := range []string{
+		"# TYPE groupcache_group_gets_total counter",
+		"groupcache_group_gets_total{" + group + "} 3",
+		"groupcache_group_cache_hits_total{" + group + "} 2",
+		"groupcache_group_local_loads_total{" + group + "} 1",
+		"groupcache_cache_items{" + group + `,cache="main"} 1`,
+		"groupcache_cache_items{" + group + `,cache="hot"} 0`,
+		"# TYPE groupcache_local_load_duration_seconds histogram",
+		"groupcache_local_load_duration_seconds_bucket{" + group + `,le="+Inf"} 1`,
+		"groupcache_local_load_duration_seconds_count{" + group + "} 1",
+		"groupcache_peer_fetch_duration_seconds_count{" + group + "} 0",
+	} {
+		if !strings.Contains(out, "\n"+line+"\n") && !strings.HasPrefix(out, line+"\n") {
+			t.Errorf("output lacks %q", line)
+		}
+	}
+
+	families := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		name := strings.Fields(line)[2]
+		if families[name] {
+			t.Errorf("metric family %s is declared twice", name)
+		}
+		families[name] = true
+	}
+
+	st := reflect.TypeOf(Stats{})
+	for i := 0; i < st.NumField(); i++ {
+		if name := "groupcache_group_" + snakeCase(st.Field(i).Name) + "_total{"; !strings.Contains(out, name) {
+			t.Errorf("output lacks %s}", name)
+		}
+	}
+	if n := reflect.TypeOf(CacheStats{}).NumField(); n != len(cacheMetrics) {
+		t.Errorf("%d metrics for the %d fields of CacheStats", len(cacheMetrics), n)
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	if got, want := labelValue("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("labelValue = %s; want %s", got, want)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	g := NewGroupOpts("TestPublishExpvar-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: fakePeers(nil)})
+	defer DeregisterGroup(g.Name())
+	var s string
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+
+	PublishExpvar("TestPublishExpvar")
+	var m map[string]groupMetrics
+	if err := json.Unmarshal([]byte(expvar.Get("TestPublishExpvar").String()), &m); err != nil {
+		t.Fatal(err)
+	}
+	gm, ok := m[g.Name()]
+	if !ok {
+		t.Fatalf("expvar lacks %s: %v", g.Name(), m)
+	}
+	if gm.Stats["Gets"] != 1 || gm.MainCache.Items != 1 || gm.LocalLoadLatency.Count != 1 {
+		t.Errorf("expvar metrics = %+v; want 1 get, 1 item and 1 local load", gm)
+	}
+}
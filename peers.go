@@ -19,6 +19,9 @@ limitations under the License.
 package groupcache
 
 import (
+	"io"
+	"sync"
+
 	pb "github.com/golang/groupcache/groupcachepb"
 )
 
@@ -32,6 +35,16 @@ type ProtoGetter interface {
 	Get(context Context, in *pb.GetRequest, out *pb.GetResponse) error
 }
 
+// A StreamGetter is a ProtoGetter that can also stream a value from
+// its peer, for Gets into a WriterSink.
+type StreamGetter interface {
+	ProtoGetter
+
+	// GetStream is like Get, but writes the value to w as it
+	// arrives rather than setting out.Value.
+	GetStream(context Context, in *pb.GetRequest, out *pb.GetResponse, w io.Writer) error
+}
+
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
 type PeerPicker interface {
@@ -41,24 +54,50 @@ type PeerPicker interface {
 	PickPeer(key string) (peer ProtoGetter, ok bool)
 }
 
+// MultiPeerPicker is a PeerPicker that can also name the peers that
+// should take over a key when its owner fails.
+type MultiPeerPicker interface {
+	PeerPicker
+
+	// PickN returns up to n owners of the key in order of
+	// preference, the first being the one PickPeer returns. The
+	// list ends before the current peer, so it is empty if the
+	// current peer is the preferred owner.
+	PickN(key string, n int) []ProtoGetter
+}
+
 // NoPeers is an implementation of PeerPicker that never finds a peer.
 type NoPeers struct{}
 
 func (NoPeers) PickPeer(key string) (peer ProtoGetter, ok bool) { return }
 
 var (
-	portPicker func(groupName string) PeerPicker
+	portPickerMu sync.Mutex
+	portPicker   func(groupName string) PeerPicker
 )
 
 // RegisterPeerPicker registers the peer initialization function.
 // It is called once, when the first group is created.
 // Either RegisterPeerPicker or RegisterPerGroupPeerPicker should be
-// called exactly once, but not both.
+// called exactly once, but not both. Groups created with
+// GroupOptions.Peers do not use it.
 func RegisterPeerPicker(fn func() PeerPicker) {
-	if portPicker != nil {
+	if !registerDefaultPeerPicker(fn) {
 		panic("RegisterPeerPicker called more than once")
 	}
+}
+
+// registerDefaultPeerPicker registers fn like RegisterPeerPicker,
+// unless a peer initialization function is already registered, and
+// reports whether it did.
+func registerDefaultPeerPicker(fn func() PeerPicker) bool {
+	portPickerMu.Lock()
+	defer portPickerMu.Unlock()
+	if portPicker != nil {
+		return false
+	}
 	portPicker = func(_ string) PeerPicker { return fn() }
+	return true
 }
 
 // RegisterPerGroupPeerPicker registers the peer initialization function,
@@ -67,6 +106,8 @@ func RegisterPeerPicker(fn func() PeerPicker) {
 // Either RegisterPeerPicker or RegisterPerGroupPeerPicker should be
 // called exactly once, but not both.
 func RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
+	portPickerMu.Lock()
+	defer portPickerMu.Unlock()
 	if portPicker != nil {
 		panic("RegisterPeerPicker called more than once")
 	}
@@ -74,10 +115,13 @@ func RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
 }
 
 func getPeers(groupName string) PeerPicker {
-	if portPicker == nil {
+	portPickerMu.Lock()
+	picker := portPicker
+	portPickerMu.Unlock()
+	if picker == nil {
 		return NoPeers{}
 	}
-	pk := portPicker(groupName)
+	pk := picker(groupName)
 	if pk == nil {
 		pk = NoPeers{}
 	}
@@ -0,0 +1,257 @@
+// protocol.go tells peers of different versions apart: on first
+// contact, peers exchange a Hello naming their protocol version and
+// capabilities, and features a peer lacks are not asked of it.
+
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// protocolVersion is the version of the peer protocol spoken here.
+// Version 0 is that of peers predating Hello.
+const protocolVersion = 1
+
+const (
+	helloPath = "_hello"
+
+	// helloRetryInterval is how long to wait before greeting a
+	// peer again after failing to reach it.
+	helloRetryInterval = time.Second
+
+	// legacyHelloTTL is how long a peer found to predate Hello is
+	// taken to, before it is greeted again.
+	legacyHelloTTL = time.Minute
+
+	// helloTimeout bounds a greeting.
+	helloTimeout = 5 * time.Second
+)
+
+// A CapabilityGetter is a ProtoGetter that can tell which version of
+// the protocol its peer speaks, and which of its features it supports.
+// Features are only used with peers that support them; ProtoGetters
+// that are not CapabilityGetters are assumed to support all.
+type CapabilityGetter interface {
+	ProtoGetter
+
+	// Capabilities returns the Hello of the peer, greeting it on
+	// first use.
+	Capabilities(context Context) (*pb.Hello, error)
+}
+
+// errUnsupported is returned for a request needing a capability the
+// peer lacks.
+var errUnsupported = errors.New("groupcache: peer does not support the request")
+
+// legacyHello is the Hello of a peer predating Hello.
+var legacyHello = &pb.Hello{Version: proto.Uint32(0), Capabilities: proto.Uint64(0)}
+
+// supports reports whether peer supports c, greeting it if need be.
+// A peer that cannot be greeted is taken to support nothing.
+func supports(ctx Context, peer ProtoGetter, c pb.Capability) bool {
+	cg, ok := peer.(CapabilityGetter)
+	if !ok {
+		return true
+	}
+	hello, err := cg.Capabilities(ctx)
+	return err == nil && hello.GetCapabilities()&uint64(c) != 0
+}
+
+// newHello returns a Hello announcing caps.
+func newHello(caps ...pb.Capability) *pb.Hello {
+	var bits uint64
+	for _, c := range caps {
+		bits |= uint64(c)
+	}
+	return &pb.Hello{Version: proto.Uint32(protocolVersion), Capabilities: proto.Uint64(bits)}
+}
+
+// peerHello remembers the Hello of a peer.
+type peerHello struct {
+	mu       sync.Mutex
+	hello    *pb.Hello     // nil until learned
+	expire   time.Time     // when to greet again a peer found legacy
+	err      error         // of the last failed greeting
+	retryAt  time.Time     // when to greet again after err
+	greeting chan struct{} // closed when the greeting in flight ends
+}
+
+// get returns the peer's Hello, calling greet to learn it if it is
+// not known yet. A failed greeting is not retried for a while.
+//
+// The greeting runs in the background, bounded by helloTimeout rather
+// than ctx, so that callers waiting for it give up with their own ctx
+// without failing it for others. A peer found legacy is greeted again
+// after legacyHelloTTL, in case it has since been upgraded, while its
+// legacy Hello goes on being returned.
+func (ph *peerHello) get(ctx Context, greet func(context.Context) (*pb.Hello, error)) (*pb.Hello, error) {
+	ph.mu.Lock()
+	now := timeNow()
+	if ph.hello != nil && (ph.expire.IsZero() || now.Before(ph.expire)) {
+		defer ph.mu.Unlock()
+		return ph.hello, nil
+	}
+	if ph.hello == nil && ph.err != nil && now.Before(ph.retryAt) {
+		defer ph.mu.Unlock()
+		return nil, ph.err
+	}
+	if ph.greeting == nil {
+		ph.greeting = make(chan struct{})
+		go ph.greet(greet)
+	}
+	hello, done := ph.hello, ph.greeting
+	ph.mu.Unlock()
+	if hello != nil {
+		return hello, nil
+	}
+
+	var canceled <-chan struct{}
+	if c, ok := ctx.(context.Context); ok {
+		canceled = c.Done()
+	}
+	select {
+	case <-done:
+	case <-canceled:
+		return nil, ctx.(context.Context).Err()
+	}
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if ph.hello != nil {
+		return ph.hello, nil
+	}
+	return nil, ph.err
+}
+
+// greet runs greet, the greeting get started, and records its result.
+func (ph *peerHello) greet(greet func(context.Context) (*pb.Hello, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), helloTimeout)
+	defer cancel()
+	hello, err := greet(ctx)
+
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	now := timeNow()
+	switch {
+	case err != nil && ph.hello != nil:
+		// The peer was found legacy before; it still is until
+		// it can be greeted.
+		ph.expire = now.Add(helloRetryInterval)
+	case err != nil:
+		ph.err, ph.retryAt = err, now.Add(helloRetryInterval)
+	default:
+		ph.hello, ph.err, ph.expire = hello, nil, time.Time{}
+		if hello.GetVersion() == 0 {
+			ph.expire = now.Add(legacyHelloTTL)
+		}
+	}
+	close(ph.greeting)
+	ph.greeting = nil
+}
+
+// hello returns the pool's Hello.
+func (p *HTTPPool) hello() *pb.Hello {
+	caps := []pb.Capability{pb.Capability_CAP_PUT, pb.Capability_CAP_HANDOFF, pb.Capability_CAP_STREAM}
+	if len(p.opts.Compression) > 0 {
+		caps = append(caps, pb.Capability_CAP_COMPRESSION)
+	}
+	return newHello(caps...)
+}
+
+// serveHello answers a peer's Hello, whose request body is body,
+// with the pool's.
+func (p *HTTPPool) serveHello(w http.ResponseWriter, body []byte) {
+	if err := proto.Unmarshal(body, new(pb.Hello)); err != nil {
+		httpError(w, http.StatusBadRequest, "bad_hello", "decoding hello: "+err.Error())
+		return
+	}
+	out, err := proto.Marshal(p.hello())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
+
+// Capabilities implements CapabilityGetter.
+func (h *httpGetter) Capabilities(ctx Context) (*pb.Hello, error) {
+	if h.hello == nil {
+		// Not made by a pool, so presumably for a peer like it.
+		return newHello(pb.Capability_CAP_PUT, pb.Capability_CAP_HANDOFF, pb.Capability_CAP_COMPRESSION, pb.Capability_CAP_STREAM), nil
+	}
+	return h.hello.get(ctx, func(c context.Context) (*pb.Hello, error) { return h.greet(ctx, c) })
+}
+
+// greet sends the pool's Hello to h's peer, with the transport for ctx
+// and bound to c, and returns the peer's.
+func (h *httpGetter) greet(ctx Context, c context.Context) (*pb.Hello, error) {
+	body, err := proto.Marshal(h.pool.hello())
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", h.baseURL+helloPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.sign(req, body); err != nil {
+		return nil, err
+	}
+	res, err := h.roundTripper(ctx).RoundTrip(req.WithContext(c))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed:
+		// Peers predating Hello take it for a malformed Get.
+		return legacyHello, nil
+	default:
+		return nil, statusError(res)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading hello: %v", err)
+	}
+	hello := new(pb.Hello)
+	if err := proto.Unmarshal(b, hello); err != nil {
+		return nil, fmt.Errorf("decoding hello: %v", err)
+	}
+	return hello, nil
+}
+
+// grpcHello returns the Hello of a GRPCPool.
+func grpcHello() *pb.Hello {
+	return newHello(pb.Capability_CAP_PUT)
+}
+
+// Capabilities implements CapabilityGetter.
+func (h *grpcGetter) Capabilities(ctx Context) (*pb.Hello, error) {
+	return h.hello.get(ctx, func(c context.Context) (*pb.Hello, error) {
+		cc, err := h.conn()
+		if err != nil {
+			return nil, err
+		}
+		out := new(pb.Hello)
+		err = cc.Invoke(c, pb.GroupCache_Hello_FullMethodName, grpcHello(), out)
+		if status.Code(err) == codes.Unimplemented {
+			return legacyHello, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+}
@@ -0,0 +1,211 @@
+package groupcache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHello(t *testing.T) {
+	for _, compression := range [][]string{nil, {"gzip"}} {
+		server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Compression: compression}}
+		server.Set()
+		srv := httptest.NewServer(server)
+		defer srv.Close()
+
+		client := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+		client.Set(srv.URL)
+		hello, err := client.httpGetters[srv.URL].Capabilities(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hello.GetVersion() != protocolVersion {
+			t.Errorf("version = %d; want %d", hello.GetVersion(), protocolVersion)
+		}
+		want := newHello(pb.Capability_CAP_PUT, pb.Capability_CAP_HANDOFF, pb.Capability_CAP_STREAM).GetCapabilities()
+		if compression != nil {
+			want |= uint64(pb.Capability_CAP_COMPRESSION)
+		}
+		if got := hello.GetCapabilities(); got != want {
+			t.Errorf("server compressing with %v: capabilities = %b; want %b", compression, got, want)
+		}
+	}
+}
+
+// legacyPeer serves Gets the way peers predating Hello did, recording
+// the requests it gets.
+type legacyPeer struct {
+	mu       sync.Mutex
+	requests []string // method, path and whether a body came
+}
+
+func (l *legacyPeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	l.mu.Lock()
+	l.requests = append(l.requests, r.Method+" "+r.URL.Path+map[bool]string{true: " with body"}[len(body) > 0])
+	l.mu.Unlock()
+	if r.Header.Get("Accept-Encoding") != "" && r.Header.Get("Accept-Encoding") != "gzip" {
+		http.Error(w, "unexpected Accept-Encoding", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, defaultBasePath), "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	b, _ := proto.Marshal(&pb.GetResponse{Value: []byte("legacy:" + parts[1])})
+	w.Write(b)
+}
+
+func TestLegacyPeer(t *testing.T) {
+	legacy := new(legacyPeer)
+	srv := httptest.NewServer(legacy)
+	defer srv.Close()
+
+	client := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, Compression: []string{"zstd"}}}
+	client.Set(srv.URL)
+	h := client.httpGetters[srv.URL]
+	hello, err := h.Capabilities(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.GetVersion() != 0 || hello.GetCapabilities() != 0 {
+		t.Errorf("legacy peer's hello = %v; want version 0 without capabilities", hello)
+	}
+
+	localLoads := 0
+	g := NewGroupOpts("TestLegacyPeer-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		localLoads++
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{Peers: client})
+	defer DeregisterGroup(g.Name())
+
+	// Gets still work, without asking for compression.
+	var s string
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil || s != "legacy:k" {
+		t.Errorf("Get = %q, %v; want %q", s, err, "legacy:k")
+	}
+	// Saves are made locally rather than sent to the peer.
+	if err := g.Save(nil, "saved", StringSink(new(string))); err != nil {
+		t.Errorf("Save: %v", err)
+	}
+	if localLoads != 1 {
+		t.Errorf("%d local loads; want 1 for the Save", localLoads)
+	}
+	// Nor is anything handed off to it.
+	if err := h.put(nil, g.Name(), "k", &pb.GetResponse{Value: []byte("v")}); err != errUnsupported {
+		t.Errorf("handoff to legacy peer = %v; want %v", err, errUnsupported)
+	}
+
+	legacy.mu.Lock()
+	defer legacy.mu.Unlock()
+	want := []string{
+		"POST " + defaultBasePath + helloPath + " with body",
+		"GET " + defaultBasePath + g.Name() + "/k",
+	}
+	if strings.Join(legacy.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("legacy peer got requests %q; want %q", legacy.requests, want)
+	}
+}
+
+func TestLegacyPeerUpgraded(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	var upgraded int32
+	server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	server.Set()
+	legacy := new(legacyPeer)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&upgraded) == 0 {
+			legacy.ServeHTTP(w, r)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	client := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	client.Set(srv.URL)
+	h := client.httpGetters[srv.URL]
+	if hello, err := h.Capabilities(nil); err != nil || hello.GetVersion() != 0 {
+		t.Fatalf("hello = %v, %v; want version 0", hello, err)
+	}
+
+	// Once upgraded, the peer is found out when next greeted.
+	atomic.StoreInt32(&upgraded, 1)
+	now = now.Add(legacyHelloTTL)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hello, err := h.Capabilities(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hello.GetVersion() == protocolVersion {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upgraded peer still taken for a legacy one")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSlowHello(t *testing.T) {
+	release := make(chan bool)
+	server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	server.Set()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		server.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	client := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	client.Set(srv.URL)
+	h := client.httpGetters[srv.URL]
+
+	// Callers waiting on a slow greeting give up with their own
+	// Context, without failing the greeting.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := h.Capabilities(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Capabilities during a slow greeting = %v; want %v", err, context.DeadlineExceeded)
+		}
+	}
+	close(release)
+	if hello, err := h.Capabilities(nil); err != nil || hello.GetVersion() != protocolVersion {
+		t.Errorf("hello = %v, %v; want version %d", hello, err, protocolVersion)
+	}
+}
+
+func TestGRPCHello(t *testing.T) {
+	peers := make(bufconnPeers)
+	server := &GRPCPool{self: "server"}
+	server.Set("server")
+	peers.serve(t, "server", server)
+
+	client := &GRPCPool{self: "client", opts: GRPCPoolOptions{DialOptions: []grpc.DialOption{peers.dialer()}}}
+	defer client.Close()
+	client.Set("server")
+	peer, _ := client.PickPeer("k")
+	hello, err := peer.(CapabilityGetter).Capabilities(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.GetVersion() != protocolVersion || hello.GetCapabilities() != uint64(pb.Capability_CAP_PUT) {
+		t.Errorf("hello = %v; want version %d with CAP_PUT", hello, protocolVersion)
+	}
+}
@@ -0,0 +1,122 @@
+// retry.go decides when and how soon httpGetter retries a failed
+// request to a peer.
+
+package groupcache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBackoff = 10 * time.Millisecond
+	maxRetryBackoff     = time.Second
+	defaultRetryBudget  = 0.1
+
+	// retryReserve is how many retries may be made before any
+	// requests have paid for them.
+	retryReserve = 10
+)
+
+// retryBudget allows retries in proportion to requests. The zero value
+// holds the full reserve.
+type retryBudget struct {
+	mu   sync.Mutex
+	debt float64 // retries made beyond what requests have paid for
+}
+
+// deposit pays for ratio of a retry.
+func (b *retryBudget) deposit(ratio float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.debt -= ratio; b.debt < 0 {
+		b.debt = 0
+	}
+}
+
+// withdraw reports whether a retry may be made, and if so takes it
+// from the budget.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.debt+1 > retryReserve {
+		return false
+	}
+	b.debt++
+	return true
+}
+
+// fundRetries adds a request to its pool's retry budget.
+func (h *httpGetter) fundRetries() {
+	p := h.pool
+	if p == nil || p.opts.Retries <= 0 {
+		return
+	}
+	ratio := p.opts.RetryBudget
+	if ratio <= 0 {
+		ratio = defaultRetryBudget
+	}
+	p.budget.deposit(ratio)
+}
+
+// retryAllowed reports whether a request that failed on its given
+// attempt, counting from zero, may be retried.
+func (h *httpGetter) retryAllowed(attempt int) bool {
+	p := h.pool
+	if p == nil || attempt >= p.opts.Retries {
+		return false
+	}
+	if !p.budget.withdraw() {
+		p.Stats.RetriesDenied.Add(1)
+		return false
+	}
+	p.Stats.Retries.Add(1)
+	return true
+}
+
+// backoff returns how long to wait before retrying a request that
+// failed on its given attempt: exponentially longer each time, up to
+// a second, less a random amount of up to half.
+func (h *httpGetter) backoff(attempt int) time.Duration {
+	d := defaultRetryBackoff
+	if h.pool != nil && h.pool.opts.RetryBackoff > 0 {
+		d = h.pool.opts.RetryBackoff
+	}
+	max := maxRetryBackoff
+	if d > max {
+		max = d
+	}
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleepContext sleeps for d, and reports whether it did so without
+// ctx being canceled first.
+func sleepContext(ctx Context, d time.Duration) bool {
+	c, ok := ctx.(context.Context)
+	if !ok {
+		time.Sleep(d)
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.Done():
+		return false
+	}
+}
+
+// abandoned reports whether ctx has been canceled by the caller.
+func abandoned(ctx Context) bool {
+	c, ok := ctx.(context.Context)
+	return ok && c.Err() != nil
+}
@@ -0,0 +1,103 @@
+package groupcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTPGetterRetries(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := proto.Marshal(&pb.GetResponse{Value: []byte("v")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, Retries: 2, RetryBackoff: time.Millisecond}}
+	p.Set(srv.URL)
+	out := new(pb.GetResponse)
+	if err := p.httpGetters[srv.URL].Get(nil, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("k")}, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Value) != "v" {
+		t.Errorf("value = %q; want %q", out.Value, "v")
+	}
+	if got := p.Stats.Retries.Get(); got != 2 {
+		t.Errorf("Retries = %d; want 2", got)
+	}
+
+	// A save is not retried.
+	atomic.StoreInt32(&requests, 0)
+	in := &pb.GetRequest{Group: proto.String("g"), Key: proto.String("k"), Value: []byte("v")}
+	if err := p.httpGetters[srv.URL].Get(nil, in, new(pb.GetResponse)); err == nil {
+		t.Error("save to busy peer succeeded")
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("save made %d requests; want 1", got)
+	}
+}
+
+func TestHTTPGetterTimeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	p := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, RequestTimeout: 20 * time.Millisecond}}
+	p.Set(srv.URL)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.httpGetters[srv.URL].Get(nil, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("k")}, new(pb.GetResponse))
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Get from stuck peer succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get from stuck peer did not time out")
+	}
+}
+
+func TestHTTPGetterBadURL(t *testing.T) {
+	h := &httpGetter{baseURL: "://bad/"}
+	if err := h.Get(nil, &pb.GetRequest{Group: proto.String("g"), Key: proto.String("k")}, new(pb.GetResponse)); err == nil {
+		t.Error("Get with a bad URL succeeded")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var b retryBudget
+	for i := 0; i < retryReserve; i++ {
+		if !b.withdraw() {
+			t.Fatalf("retry %d denied within the reserve", i)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("retry allowed beyond the reserve")
+	}
+	for i := 0; i < 4; i++ {
+		b.deposit(0.25)
+	}
+	if !b.withdraw() {
+		t.Error("retry denied after four requests at 0.25")
+	}
+	if b.withdraw() {
+		t.Error("second retry allowed after four requests at 0.25")
+	}
+}
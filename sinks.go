@@ -18,8 +18,10 @@ package groupcache
 
 import (
 	"errors"
+	"io"
 
-	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
 )
 
 // A Sink receives data from a Get call.
@@ -35,13 +37,20 @@ type Sink interface {
 	SetBytes(v []byte) error
 
 	// SetProto sets the value to the encoded version of m.
-	// The caller retains ownership of m.
-	SetProto(m proto.Message) error
+	// The caller retains ownership of m. Messages generated by
+	// both google.golang.org/protobuf and the older
+	// github.com/golang/protobuf are accepted.
+	SetProto(m protoadapt.MessageV1) error
 
 	// view returns a frozen view of the bytes for caching.
 	View() (ByteView, error)
 }
 
+// marshalProto encodes m, a message of either protobuf API.
+func marshalProto(m protoadapt.MessageV1) ([]byte, error) {
+	return proto.Marshal(protoadapt.MessageV2Of(m))
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -92,8 +101,8 @@ func (s *stringSink) SetBytes(v []byte) error {
 	return s.SetString(string(v))
 }
 
-func (s *stringSink) SetProto(m proto.Message) error {
-	b, err := proto.Marshal(m)
+func (s *stringSink) SetProto(m protoadapt.MessageV1) error {
+	b, err := marshalProto(m)
 	if err != nil {
 		return err
 	}
@@ -132,8 +141,8 @@ func (s *byteViewSink) View() (ByteView, error) {
 	return *s.dst, nil
 }
 
-func (s *byteViewSink) SetProto(m proto.Message) error {
-	b, err := proto.Marshal(m)
+func (s *byteViewSink) SetProto(m protoadapt.MessageV1) error {
+	b, err := marshalProto(m)
 	if err != nil {
 		return err
 	}
@@ -151,10 +160,12 @@ func (s *byteViewSink) SetString(v string) error {
 	return nil
 }
 
-// ProtoSink returns a sink that unmarshals binary proto values into m.
-func ProtoSink(m proto.Message) Sink {
+// ProtoSink returns a sink that unmarshals binary proto values into m,
+// which, like the argument of SetProto, may be generated by either
+// protobuf API.
+func ProtoSink(m protoadapt.MessageV1) Sink {
 	return &protoSink{
-		dst: m,
+		dst: protoadapt.MessageV2Of(m),
 	}
 }
 
@@ -190,8 +201,8 @@ func (s *protoSink) SetString(v string) error {
 	return nil
 }
 
-func (s *protoSink) SetProto(m proto.Message) error {
-	b, err := proto.Marshal(m)
+func (s *protoSink) SetProto(m protoadapt.MessageV1) error {
+	b, err := marshalProto(m)
 	if err != nil {
 		return err
 	}
@@ -234,8 +245,8 @@ func (s *allocBytesSink) setView(v ByteView) error {
 	return nil
 }
 
-func (s *allocBytesSink) SetProto(m proto.Message) error {
-	b, err := proto.Marshal(m)
+func (s *allocBytesSink) SetProto(m protoadapt.MessageV1) error {
+	b, err := marshalProto(m)
 	if err != nil {
 		return err
 	}
@@ -283,8 +294,8 @@ func (s *truncBytesSink) View() (ByteView, error) {
 	return s.v, nil
 }
 
-func (s *truncBytesSink) SetProto(m proto.Message) error {
-	b, err := proto.Marshal(m)
+func (s *truncBytesSink) SetProto(m protoadapt.MessageV1) error {
+	b, err := marshalProto(m)
 	if err != nil {
 		return err
 	}
@@ -320,3 +331,54 @@ func (s *truncBytesSink) SetString(v string) error {
 	s.v.s = v
 	return nil
 }
+
+// WriterSink returns a Sink that writes the value to w. Given to
+// Group.Get, it streams a value owned by a peer into w as it arrives,
+// without holding all of it in memory, if the peer's ProtoGetter is a
+// StreamGetter. Values streamed that way are not mirrored in the
+// hotCache, and concurrent Gets of the key are not deduplicated.
+//
+// A WriterSink has no view of the value; Getters must not be given
+// one directly.
+func WriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	w       io.Writer
+	written int64
+}
+
+func (s *writerSink) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+func (s *writerSink) setView(v ByteView) error {
+	_, err := v.WriteTo(s)
+	return err
+}
+
+func (s *writerSink) View() (ByteView, error) {
+	return ByteView{}, errors.New("groupcache: a WriterSink has no view")
+}
+
+func (s *writerSink) SetProto(m protoadapt.MessageV1) error {
+	b, err := marshalProto(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.Write(b)
+	return err
+}
+
+func (s *writerSink) SetBytes(b []byte) error {
+	_, err := s.Write(b)
+	return err
+}
+
+func (s *writerSink) SetString(v string) error {
+	_, err := io.WriteString(s, v)
+	return err
+}
@@ -0,0 +1,292 @@
+// snapshot.go saves and restores a group's mainCache, so that a
+// restarted peer need not reload all of its keys from the backend.
+
+package groupcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A snapshot is laid out as:
+//
+//	magic    [4]byte "gcsn"
+//	version  uvarint
+//	entries  {1, key, value, staleAt, expire}...
+//	end      0
+//	checksum uint32, big endian, CRC-32C of everything before it
+//
+// Keys and values are written as a uvarint length followed by their
+// bytes, and times as varint Unix nanoseconds, zero meaning none.
+const (
+	snapshotMagic   = "gcsn"
+	snapshotVersion = 1
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Snapshot writes the entries of the group's mainCache to w, from
+// which Restore can later reload them. Negative entries are not
+// saved.
+func (g *Group) Snapshot(w io.Writer) error {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc32.New(crc32c)}
+	sw.writeString(snapshotMagic)
+	sw.writeUvarint(snapshotVersion)
+	for _, ke := range g.mainCache.entries() {
+		if ke.err != nil {
+			continue
+		}
+		sw.writeByte(1)
+		sw.writeUvarint(uint64(len(ke.key)))
+		sw.writeString(ke.key)
+		sw.writeUvarint(uint64(ke.value.Len()))
+		if sw.err == nil {
+			_, sw.err = ke.value.WriteTo(sw)
+		}
+		sw.writeTime(ke.staleAt)
+		sw.writeTime(ke.expire)
+	}
+	sw.writeByte(0)
+	if sw.err != nil {
+		return sw.err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], sw.crc.Sum32())
+	if _, err := sw.w.Write(sum[:]); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// Restore adds the entries of a snapshot written by Snapshot to the
+// group's mainCache. Entries that have expired since are skipped.
+// Nothing is added unless the whole snapshot is intact.
+func (g *Group) Restore(r io.Reader) error {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.New(crc32c)}
+	if magic := sr.readBytes(uint64(len(snapshotMagic))); sr.err == nil && string(magic) != snapshotMagic {
+		return errors.New("groupcache: not a snapshot")
+	}
+	if v := sr.readUvarint(); sr.err == nil && v != snapshotVersion {
+		return fmt.Errorf("groupcache: unsupported snapshot version %d", v)
+	}
+	var entries []keyedEntry
+	for sr.err == nil {
+		// Each entry is preceded by a 1, and the last by a 0.
+		marker := sr.readByte()
+		if sr.err != nil || marker == 0 {
+			break
+		}
+		if marker != 1 {
+			return fmt.Errorf("groupcache: corrupt snapshot: entry marker %d", marker)
+		}
+		var ke keyedEntry
+		ke.key = string(sr.readBytes(sr.readUvarint()))
+		ke.value = ByteView{b: sr.readBytes(sr.readUvarint())}
+		ke.staleAt = sr.readTime()
+		ke.expire = sr.readTime()
+		entries = append(entries, ke)
+	}
+	if sr.err != nil {
+		return fmt.Errorf("groupcache: reading snapshot: %v", sr.err)
+	}
+	want := sr.crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return fmt.Errorf("groupcache: reading snapshot: %v", err)
+	}
+	if binary.BigEndian.Uint32(sum[:]) != want {
+		return errors.New("groupcache: snapshot checksum mismatch")
+	}
+
+	now := timeNow()
+	for _, ke := range entries {
+		if ke.expired(now) {
+			continue
+		}
+		g.populateCache(ke.key, ke.cacheEntry, &g.mainCache)
+	}
+	return nil
+}
+
+// snapshotPath returns the file in dir holding the snapshot of the
+// named group.
+func snapshotPath(dir, name string) string {
+	return filepath.Join(dir, url.QueryEscape(name)+".snapshot")
+}
+
+// restoreFile restores the group from its snapshot in dir, if any.
+func (g *Group) restoreFile(dir string) error {
+	f, err := os.Open(snapshotPath(dir, g.name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.Restore(f)
+}
+
+// snapshotFile replaces the group's snapshot in dir. The old snapshot
+// stays in place until the new one is complete.
+func (g *Group) snapshotFile(dir string) error {
+	f, err := ioutil.TempFile(dir, ".snapshot")
+	if err != nil {
+		return err
+	}
+	err = g.Snapshot(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), snapshotPath(dir, g.name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// snapshotLoop writes the group's snapshot to dir every interval,
+// and once more when stop is closed.
+func (g *Group) snapshotLoop(dir string, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-stop:
+			if err := g.snapshotFile(dir); err != nil {
+				g.logger().log(LogError, "snapshot failed", LogField{"group", g.name}, LogField{"error", err})
+			}
+			return
+		}
+		if err := g.snapshotFile(dir); err != nil {
+			g.logger().log(LogError, "snapshot failed", LogField{"group", g.name}, LogField{"error", err})
+		}
+	}
+}
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	err error
+}
+
+func (sw *snapshotWriter) Write(p []byte) (int, error) {
+	sw.crc.Write(p)
+	return sw.w.Write(p)
+}
+
+func (sw *snapshotWriter) writeString(s string) {
+	if sw.err == nil {
+		_, sw.err = io.WriteString(sw, s)
+	}
+}
+
+func (sw *snapshotWriter) writeByte(c byte) {
+	if sw.err == nil {
+		_, sw.err = sw.Write([]byte{c})
+	}
+}
+
+func (sw *snapshotWriter) writeUvarint(x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	if sw.err == nil {
+		_, sw.err = sw.Write(buf[:binary.PutUvarint(buf[:], x)])
+	}
+}
+
+func (sw *snapshotWriter) writeTime(t time.Time) {
+	var buf [binary.MaxVarintLen64]byte
+	var ns int64
+	if !t.IsZero() {
+		ns = t.UnixNano()
+	}
+	if sw.err == nil {
+		_, sw.err = sw.Write(buf[:binary.PutVarint(buf[:], ns)])
+	}
+}
+
+// maxSnapshotString bounds the length of a key or value read from a
+// snapshot, so that a corrupt length cannot exhaust memory.
+const maxSnapshotString = 1 << 30
+
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	c, err := sr.r.ReadByte()
+	if err == nil {
+		sr.crc.Write([]byte{c})
+	}
+	return c, err
+}
+
+func (sr *snapshotReader) readByte() byte {
+	if sr.err != nil {
+		return 0
+	}
+	var c byte
+	c, sr.err = sr.ReadByte()
+	if sr.err == io.EOF {
+		sr.err = io.ErrUnexpectedEOF
+	}
+	return c
+}
+
+func (sr *snapshotReader) readBytes(n uint64) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	if n > maxSnapshotString {
+		sr.err = fmt.Errorf("invalid length %d", n)
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, sr.err = io.ReadFull(sr.r, buf); sr.err != nil {
+		return nil
+	}
+	sr.crc.Write(buf)
+	return buf
+}
+
+func (sr *snapshotReader) readUvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	var x uint64
+	x, sr.err = binary.ReadUvarint(sr)
+	if sr.err == io.EOF {
+		sr.err = io.ErrUnexpectedEOF
+	}
+	return x
+}
+
+func (sr *snapshotReader) readTime() time.Time {
+	if sr.err != nil {
+		return time.Time{}
+	}
+	var ns int64
+	ns, sr.err = binary.ReadVarint(sr)
+	if sr.err == io.EOF {
+		sr.err = io.ErrUnexpectedEOF
+	}
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
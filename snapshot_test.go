@@ -0,0 +1,149 @@
+package groupcache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	getter := GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value-of-" + key)
+	})
+	opts := &GroupOptions{Peers: NoPeers{}, HardTTL: time.Minute}
+	src := NewGroupOpts("TestSnapshotRestore-src", cacheSize, getter, opts)
+	for i := 0; i < 10; i++ {
+		var s string
+		if err := src.Get(dummyCtx, fmt.Sprintf("key-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap := buf.Bytes()
+
+	var loads int
+	dst := NewGroupOpts("TestSnapshotRestore-dst", cacheSize, GetterFunc(func(_ Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString("reloaded")
+	}), opts)
+
+	// A damaged snapshot must leave the cache alone.
+	bad := append([]byte(nil), snap...)
+	bad[len(bad)/2] ^= 0xff
+	if err := dst.Restore(bytes.NewReader(bad)); err == nil {
+		t.Error("Restore of a corrupt snapshot succeeded")
+	}
+	bad = append([]byte(nil), snap...)
+	bad[len(snapshotMagic)+1] = 2 // the first entry's marker
+	if err := dst.Restore(bytes.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "corrupt snapshot") {
+		t.Errorf("Restore with a bad entry marker = %v; want a corrupt snapshot error", err)
+	}
+	if err := dst.Restore(bytes.NewReader(snap[:len(snap)-1])); err == nil {
+		t.Error("Restore of a truncated snapshot succeeded")
+	}
+	if n := dst.mainCache.items(); n != 0 {
+		t.Fatalf("failed Restores added %d items", n)
+	}
+
+	// Restore once the first five entries have expired.
+	now = now.Add(54 * time.Second)
+	if err := dst.Restore(bytes.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if n := dst.mainCache.items(); n != 5 {
+		t.Errorf("restored %d items; want 5", n)
+	}
+	for i := 5; i < 10; i++ {
+		var s string
+		key := fmt.Sprintf("key-%d", i)
+		if err := dst.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if want := "value-of-" + key; s != want {
+			t.Errorf("Get(%q) = %q; want %q", key, s, want)
+		}
+	}
+	if loads != 0 {
+		t.Errorf("restored keys caused %d loads", loads)
+	}
+}
+
+func TestSnapshotDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groupcache-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const name = "TestSnapshotDir/group"
+	var loads int
+	getter := GetterFunc(func(_ Context, key string, dest Sink) error {
+		loads++
+		return dest.SetString(strings.ToUpper(key))
+	})
+	opts := &GroupOptions{SnapshotDir: dir, SnapshotInterval: time.Hour}
+	g := NewGroupOpts(name, cacheSize, getter, opts)
+	var s string
+	if err := g.Get(dummyCtx, "warm", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deregistering saves a final snapshot, which the group's next
+	// incarnation starts from.
+	DeregisterGroup(name)
+	g = NewGroupOpts(name, cacheSize, getter, opts)
+	defer DeregisterGroup(name)
+	if err := g.Get(dummyCtx, "warm", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "WARM" || loads != 1 {
+		t.Errorf("Get after restart = %q with %d loads; want %q with 1", s, loads, "WARM")
+	}
+}
+
+func TestSnapshotDirWithBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groupcache-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetMemoryBudget(0)
+
+	const name = "TestSnapshotDirWithBudget/group"
+	getter := GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString(strings.ToUpper(key))
+	})
+	opts := &GroupOptions{Peers: NoPeers{}, SnapshotDir: dir, SnapshotInterval: time.Hour}
+	g := NewGroupOpts(name, cacheSize, getter, opts)
+	var s string
+	if err := g.Get(dummyCtx, "warm", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	DeregisterGroup(name)
+
+	// Restoring enforces the budget, which must not wait on the
+	// registration of the group being restored.
+	SetMemoryBudget(1 << 40)
+	done := make(chan *Group)
+	go func() { done <- NewGroupOpts(name, cacheSize, getter, opts) }()
+	select {
+	case g = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewGroupOpts restoring a snapshot under a memory budget hung")
+	}
+	defer DeregisterGroup(name)
+	if n := g.CacheStats(MainCache).Items; n != 1 {
+		t.Errorf("restored %d items; want 1", n)
+	}
+}
@@ -0,0 +1,234 @@
+// stream.go streams values from the peer that owns them into a
+// WriterSink, so that large values reach the caller a chunk at a time
+// rather than being held in memory in full.
+
+package groupcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// A streamed response, of Content-Type streamContentType, is a
+// sequence of frames, each a uvarint length followed by that many
+// bytes:
+//
+//	header  the GetResponse, without its value
+//	chunks  the value, in frames of up to streamChunkSize bytes
+//	end     an empty frame
+//
+// The end frame tells a complete value from a truncated one.
+const (
+	streamContentType = "application/x-groupcache-stream"
+	streamChunkSize   = 64 << 10
+	maxStreamFrame    = 16 << 20
+
+	// maxResponseOverhead bounds how much larger than its value a
+	// buffered response may be.
+	maxResponseOverhead = 64 << 10
+)
+
+var (
+	errValueTooLarge   = errors.New("groupcache: value exceeds MaxValueBytes")
+	errTruncatedStream = errors.New("groupcache: truncated stream")
+)
+
+// getStream gets key into ws, streaming it from its owner if that is
+// a peer able to stream it. If the peer fails before any of the value
+// is written, key is loaded from the next owner or locally instead,
+// without asking the failed peer again.
+func (g *Group) getStream(ctx Context, key string, ws *writerSink) error {
+	g.peersOnce.Do(g.initPeers)
+	if peer := g.streamPeer(key); peer != nil {
+		err := g.streamFromPeer(ctx, peer, key, ws)
+		failedLoad := finalPeerError(err)
+		if err == nil || failedLoad || ws.written > 0 {
+			// Done, for better or worse: what was written
+			// cannot be taken back.
+			g.Stats.Gets.Add(1)
+			g.Stats.Loads.Add(1)
+			if err == nil || failedLoad {
+				g.peerSucceeded(peer)
+				g.Stats.PeerLoads.Add(1)
+			}
+			return err
+		}
+		g.Stats.PeerErrors.Add(1)
+		g.peerFailed(peer, key, err)
+		g.Stats.Gets.Add(1)
+		var dest ByteView
+		value, _, err := g.load(ctx, key, ByteViewSink(&dest), peer)
+		if err != nil {
+			return err
+		}
+		return g.populateSink(ctx, key, ws, value)
+	}
+	var value ByteView
+	if err := g.get(ctx, key, ByteViewSink(&value)); err != nil {
+		return err
+	}
+	return ws.setView(value)
+}
+
+// streamPeer returns the peer to stream key from, or nil if key is
+// cached, owned by this process, or owned by a peer that cannot
+// stream.
+func (g *Group) streamPeer(key string) StreamGetter {
+	if g.CacheBytes() > 0 && (g.mainCache.contains(key) || g.hotCache.contains(key)) {
+		return nil
+	}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok || g.ejected(peer) {
+		return nil
+	}
+	sg, _ := peer.(StreamGetter)
+	return sg
+}
+
+func (g *Group) streamFromPeer(ctx Context, peer StreamGetter, key string, ws *writerSink) error {
+	req := &pb.GetRequest{
+		Group: &g.name,
+		Key:   &key,
+	}
+	res := &pb.GetResponse{}
+	start := time.Now()
+	err := peer.GetStream(ctx, req, res, ws)
+	d := time.Since(start)
+	g.peerLatency.observe(d)
+	if err == nil && res.Error != nil {
+		err = g.peerLoadError(key, res)
+	}
+	g.trace(ctx, TraceInfo{Event: TracePeerFetch, Key: key, Peer: peerName(peer), Bytes: int(ws.written), Duration: d, Err: err})
+	if err != nil {
+		return err
+	}
+	g.Stats.PeerStreams.Add(1)
+	return nil
+}
+
+// GetStream implements StreamGetter. A peer that answers without
+// streaming, as older versions do, is read as by Get. Streams are not
+// retried.
+func (h *httpGetter) GetStream(ctx Context, in *pb.GetRequest, out *pb.GetResponse, w io.Writer) error {
+	_, err := h.roundTrip(ctx, in, true, func(res *http.Response) (bool, error) {
+		if res.Header.Get("Content-Type") == streamContentType {
+			return false, readStream(res.Body, out, w, h.maxValueBytes())
+		}
+		if retry, err := h.readResponse(ctx, res, out); err != nil {
+			return retry, err
+		}
+		value := out.Value
+		out.Value = nil
+		_, err := w.Write(value)
+		return false, err
+	})
+	return err
+}
+
+// maxValueBytes returns the largest value h may fetch, or zero for
+// no limit.
+func (h *httpGetter) maxValueBytes() int64 {
+	if h.pool == nil {
+		return 0
+	}
+	return h.pool.opts.MaxValueBytes
+}
+
+// writeStream writes res to w as a streamed response.
+func writeStream(w http.ResponseWriter, res *pb.GetResponse) {
+	value := res.Value
+	res.Value = nil
+	header, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", streamContentType)
+	if writeFrame(w, header) != nil {
+		return
+	}
+	for len(value) > 0 {
+		n := len(value)
+		if n > streamChunkSize {
+			n = streamChunkSize
+		}
+		if writeFrame(w, value[:n]) != nil {
+			return
+		}
+		value = value[n:]
+	}
+	writeFrame(w, nil)
+}
+
+func writeFrame(w io.Writer, b []byte) error {
+	var n [binary.MaxVarintLen64]byte
+	if _, err := w.Write(n[:binary.PutUvarint(n[:], uint64(len(b)))]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readStream reads a streamed response from r into out, writing its
+// value to w. A value of more than max bytes fails, if max is
+// positive.
+func readStream(r io.Reader, out *pb.GetResponse, w io.Writer, max int64) error {
+	br := bufio.NewReader(r)
+	n, err := readFrameLen(br)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, n)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return streamError(err)
+	}
+	if err := proto.Unmarshal(header, out); err != nil {
+		return fmt.Errorf("decoding stream header: %v", err)
+	}
+	var total int64
+	for {
+		n, err := readFrameLen(br)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		total += n
+		if max > 0 && total > max {
+			return errValueTooLarge
+		}
+		if _, err := io.CopyN(w, br, n); err != nil {
+			return streamError(err)
+		}
+	}
+}
+
+// readFrameLen reads the length of the next frame from br.
+func readFrameLen(br *bufio.Reader) (int64, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, streamError(err)
+	}
+	if n > maxStreamFrame {
+		return 0, fmt.Errorf("groupcache: stream frame of %d bytes", n)
+	}
+	return int64(n), nil
+}
+
+// streamError returns err, a failure reading a stream, reporting the
+// stream as truncated if it ended early.
+func streamError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errTruncatedStream
+	}
+	return err
+}
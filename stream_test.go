@@ -0,0 +1,170 @@
+package groupcache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// renamedPeer is a StreamGetter asking its peer for keys of another
+// group, so that a group in this process can load from one served
+// by it too.
+type renamedPeer struct {
+	h     *httpGetter
+	group string
+}
+
+func (p *renamedPeer) Get(ctx Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	in.Group = &p.group
+	return p.h.Get(ctx, in, out)
+}
+
+func (p *renamedPeer) GetStream(ctx Context, in *pb.GetRequest, out *pb.GetResponse, w io.Writer) error {
+	in.Group = &p.group
+	return p.h.GetStream(ctx, in, out, w)
+}
+
+// streamServer serves a group, whose values are all the same 1 MiB
+// but for the absent key "absent", through its pool wrapped by wrap.
+func streamServer(t *testing.T, name string, wrap func(http.Handler) http.Handler) (*httptest.Server, []byte) {
+	value := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1 MiB
+	server := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath}}
+	g := NewGroupOpts(name, 4<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		if key == "absent" {
+			return ErrNotFound
+		}
+		return dest.SetBytes(value)
+	}), &GroupOptions{Peers: server, NegativeCacheTTL: time.Minute})
+	t.Cleanup(func() { DeregisterGroup(g.Name()) })
+	server.Set()
+	srv := httptest.NewServer(wrap(server))
+	t.Cleanup(srv.Close)
+	return srv, value
+}
+
+func streamClient(srv *httptest.Server, group string, max int64) *renamedPeer {
+	client := &HTTPPool{opts: HTTPPoolOptions{BasePath: defaultBasePath, MaxValueBytes: max}}
+	client.Set(srv.URL)
+	return &renamedPeer{h: client.httpGetters[srv.URL], group: group}
+}
+
+func TestStreamFromPeer(t *testing.T) {
+	srv, value := streamServer(t, "TestStreamFromPeer-owner", func(h http.Handler) http.Handler { return h })
+	peer := streamClient(srv, "TestStreamFromPeer-owner", 2<<20)
+	g := NewGroupOpts("TestStreamFromPeer-caller", 4<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		t.Errorf("loaded %q locally", key)
+		return dest.SetString("local")
+	}), &GroupOptions{Peers: rankedPeers{peer}})
+	defer DeregisterGroup(g.Name())
+
+	var buf bytes.Buffer
+	if err := g.Get(nil, "big", WriterSink(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), value) {
+		t.Errorf("streamed %d bytes; want the %d byte value", buf.Len(), len(value))
+	}
+	if got := g.Stats.PeerStreams.Get(); got != 1 {
+		t.Errorf("PeerStreams = %d; want 1", got)
+	}
+	if st := g.CacheStats(HotCache); st.Items != 0 {
+		t.Errorf("hotCache holds %d items after a stream; want none", st.Items)
+	}
+
+	buf.Reset()
+	if err := g.Get(nil, "absent", WriterSink(&buf)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("streaming an absent key = %v; want ErrNotFound", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("streaming an absent key wrote %d bytes", buf.Len())
+	}
+}
+
+func TestStreamMaxValueBytes(t *testing.T) {
+	srv, _ := streamServer(t, "TestStreamMaxValueBytes-owner", func(h http.Handler) http.Handler { return h })
+	peer := streamClient(srv, "TestStreamMaxValueBytes-owner", 1<<10)
+	if err := peer.GetStream(nil, &pb.GetRequest{Key: new(string)}, new(pb.GetResponse), ioutil.Discard); err != errValueTooLarge {
+		t.Errorf("GetStream of an oversized value = %v; want %v", err, errValueTooLarge)
+	}
+	if err := peer.Get(nil, &pb.GetRequest{Key: new(string)}, new(pb.GetResponse)); err != errValueTooLarge {
+		t.Errorf("Get of an oversized value = %v; want %v", err, errValueTooLarge)
+	}
+}
+
+func TestStreamFromPeerThatDoesNotStream(t *testing.T) {
+	srv, value := streamServer(t, "TestStreamFromPeerThatDoesNotStream-owner", func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("Accept")
+			h.ServeHTTP(w, r)
+		})
+	})
+	peer := streamClient(srv, "TestStreamFromPeerThatDoesNotStream-owner", 0)
+	var buf bytes.Buffer
+	if err := peer.GetStream(nil, &pb.GetRequest{Key: new(string)}, new(pb.GetResponse), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), value) {
+		t.Errorf("got %d bytes; want the %d byte value", buf.Len(), len(value))
+	}
+}
+
+// downStreamPeer is a StreamGetter that cannot be reached, counting
+// the requests made to it.
+type downStreamPeer struct {
+	requests int
+}
+
+func (p *downStreamPeer) Get(ctx Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	p.requests++
+	return errors.New("connection refused")
+}
+
+func (p *downStreamPeer) GetStream(ctx Context, in *pb.GetRequest, out *pb.GetResponse, w io.Writer) error {
+	return p.Get(ctx, in, out)
+}
+
+func TestStreamFromFailedPeer(t *testing.T) {
+	peer := new(downStreamPeer)
+	g := NewGroupOpts("TestStreamFromFailedPeer", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), &GroupOptions{Peers: rankedPeers{peer}})
+	defer DeregisterGroup(g.Name())
+
+	var buf bytes.Buffer
+	if err := g.Get(nil, "k", WriterSink(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "local:k" {
+		t.Errorf("streamed %q; want %q", buf.String(), "local:k")
+	}
+	if peer.requests != 1 {
+		t.Errorf("failed peer asked %d times; want 1", peer.requests)
+	}
+	if got := g.Stats.PeerErrors.Get(); got != 1 {
+		t.Errorf("PeerErrors = %d; want 1", got)
+	}
+}
+
+func TestReadStreamTruncated(t *testing.T) {
+	var stream bytes.Buffer
+	writeFrame(&stream, nil)
+	writeFrame(&stream, []byte("chunk"))
+	for _, n := range []int{0, 1, 3, stream.Len()} {
+		err := readStream(bytes.NewReader(stream.Bytes()[:n]), new(pb.GetResponse), ioutil.Discard, 0)
+		if err != errTruncatedStream {
+			t.Errorf("reading %d of %d bytes = %v; want %v", n, stream.Len(), err, errTruncatedStream)
+		}
+	}
+	writeFrame(&stream, nil)
+	var buf bytes.Buffer
+	if err := readStream(&stream, new(pb.GetResponse), &buf, 0); err != nil || buf.String() != "chunk" {
+		t.Errorf("reading a whole stream = %q, %v; want %q", buf.String(), err, "chunk")
+	}
+}
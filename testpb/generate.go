@@ -0,0 +1,4 @@
+// Package testpb holds the messages of groupcache's tests.
+package testpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative test.proto
@@ -0,0 +1,220 @@
+// tls.go secures the traffic between an HTTPPool's peers with TLS,
+// optionally mutual, rereading certificates as they are rotated.
+
+package groupcache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsRecheckInterval is how often certificate files are checked for
+// changes.
+const tlsRecheckInterval = time.Second
+
+// peerTLS holds a pool's certificates, reloading them when their
+// files change.
+type peerTLS struct {
+	certFile, keyFile, caFile string
+
+	mu      sync.Mutex
+	checked time.Time // when the files were last checked
+	mods    [3]time.Time
+	cert    *tls.Certificate
+	roots   *x509.CertPool // nil for the system's
+	err     error
+
+	transport *http.Transport // for requests to peers
+}
+
+// usesTLS reports whether the pool is configured for TLS.
+func (p *HTTPPool) usesTLS() bool {
+	o := &p.opts
+	return o.TLSCertFile != "" || o.TLSCAFile != "" || o.TLSRequireClientCert
+}
+
+// peerTLS returns the pool's TLS state, creating it on first use.
+func (p *HTTPPool) peerTLS() *peerTLS {
+	p.tlsOnce.Do(func() {
+		t := &peerTLS{
+			certFile: p.opts.TLSCertFile,
+			keyFile:  p.opts.TLSKeyFile,
+			caFile:   p.opts.TLSCAFile,
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = t.clientConfig()
+		t.transport = tr
+		p.tls = t
+	})
+	return p.tls
+}
+
+// ServerTLSConfig returns the TLS configuration with which to serve
+// the pool to its peers, for instance as the TLSConfig of an
+// http.Server. It presents TLSCertFile and, if TLSRequireClientCert
+// is set, only accepts peers presenting a certificate signed by
+// TLSCAFile for the host of one of the peers passed to Set.
+func (p *HTTPPool) ServerTLSConfig() *tls.Config {
+	t := p.peerTLS()
+	c := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _, err := t.load()
+			if err == nil && cert == nil {
+				err = errors.New("groupcache: no TLSCertFile configured")
+			}
+			return cert, err
+		},
+	}
+	if p.opts.TLSRequireClientCert {
+		// Verified below, against certificates that may have
+		// been reloaded.
+		c.ClientAuth = tls.RequireAnyClientCert
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, roots, err := t.load()
+			if err != nil {
+				return err
+			}
+			leaf, err := verifyChain(cs, roots, "", x509.ExtKeyUsageClientAuth)
+			if err != nil {
+				return err
+			}
+			if !p.isPeer(leaf) {
+				return fmt.Errorf("groupcache: certificate of %v is not for a peer", leaf.Subject)
+			}
+			return nil
+		}
+	}
+	return c
+}
+
+// clientConfig returns the TLS configuration for requests to peers.
+// They must present a certificate signed by TLSCAFile for their host
+// in the peer list; this peer presents TLSCertFile, if any.
+func (t *peerTLS) clientConfig() *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, err := t.load()
+			if cert == nil {
+				// Send none, and let the server decide.
+				cert = new(tls.Certificate)
+			}
+			return cert, err
+		},
+		// Verified below, against certificates that may have been
+		// reloaded.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, roots, err := t.load()
+			if err != nil {
+				return err
+			}
+			_, err = verifyChain(cs, roots, cs.ServerName, x509.ExtKeyUsageServerAuth)
+			return err
+		},
+	}
+}
+
+// verifyChain verifies the certificate chain presented in cs against
+// roots, for dnsName if not empty, and returns its leaf.
+func verifyChain(cs tls.ConnectionState, roots *x509.CertPool, dnsName string, usage x509.ExtKeyUsage) (*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("groupcache: peer presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       dnsName,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	leaf := cs.PeerCertificates[0]
+	if _, err := leaf.Verify(opts); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+// isPeer reports whether cert is valid for the host of one of the
+// peers passed to Set.
+func (p *HTTPPool) isPeer(cert *x509.Certificate) bool {
+	p.mu.Lock()
+	members := p.members
+	p.mu.Unlock()
+	for _, peer := range members {
+		u, err := url.Parse(peer)
+		if err == nil && cert.VerifyHostname(u.Hostname()) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// load returns the current certificate and roots, rereading their
+// files if they have changed since last checked. A failed reload
+// keeps the last good ones.
+func (t *peerTLS) load() (*tls.Certificate, *x509.CertPool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := timeNow()
+	if !t.checked.IsZero() && now.Sub(t.checked) < tlsRecheckInterval {
+		return t.cert, t.roots, t.err
+	}
+	t.checked = now
+
+	var mods [3]time.Time
+	for i, name := range []string{t.certFile, t.keyFile, t.caFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return t.keep(err)
+		}
+		mods[i] = fi.ModTime()
+	}
+	if mods == t.mods && t.err == nil {
+		return t.cert, t.roots, nil
+	}
+
+	var cert *tls.Certificate
+	if t.certFile != "" {
+		c, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+		if err != nil {
+			return t.keep(err)
+		}
+		cert = &c
+	}
+	var roots *x509.CertPool
+	if t.caFile != "" {
+		pem, err := ioutil.ReadFile(t.caFile)
+		if err != nil {
+			return t.keep(err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return t.keep(fmt.Errorf("groupcache: no certificates in %s", t.caFile))
+		}
+	}
+	t.mods, t.cert, t.roots, t.err = mods, cert, roots, nil
+	return cert, roots, nil
+}
+
+// keep records a failed reload, returning the last good certificate
+// and roots if there are any. t.mu must be held.
+func (t *peerTLS) keep(err error) (*tls.Certificate, *x509.CertPool, error) {
+	if t.cert != nil || t.roots != nil {
+		return t.cert, t.roots, nil
+	}
+	t.err = err
+	return nil, nil, err
+}
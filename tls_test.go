@@ -0,0 +1,217 @@
+package groupcache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, serial: 1}
+}
+
+// writeCA writes the CA's certificate to a file in dir.
+func (ca *testCA) writeCA(t *testing.T, dir string) string {
+	name := filepath.Join(dir, "ca.pem")
+	writePEM(t, name, "CERTIFICATE", ca.cert.Raw)
+	return name
+}
+
+// issue writes a certificate for host, and its key, to files in dir,
+// returning their names and the certificate's serial number.
+func (ca *testCA) issue(t *testing.T, dir, host string) (certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, host+".pem")
+	keyFile = filepath.Join(dir, host+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile, ca.serial
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte) {
+	if err := ioutil.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS serves p over TLS on a local port and returns its URL.
+func serveTLS(t *testing.T, p *HTTPPool) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: p, TLSConfig: p.ServerTLSConfig()}
+	go srv.ServeTLS(l, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return "https://" + l.Addr().String()
+}
+
+func TestMutualTLS(t *testing.T) {
+	getter := GetterFunc(func(ctx Context, key string, dest Sink) error {
+		return dest.SetString("secret:" + key)
+	})
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := ca.writeCA(t, dir)
+	certFile, keyFile, _ := ca.issue(t, dir, "127.0.0.1")
+
+	server := &HTTPPool{opts: HTTPPoolOptions{
+		BasePath:             defaultBasePath,
+		TLSCertFile:          certFile,
+		TLSKeyFile:           keyFile,
+		TLSCAFile:            caFile,
+		TLSRequireClientCert: true,
+	}}
+	g := NewGroupOpts("TestMutualTLS-group", 1<<20, getter, &GroupOptions{Peers: server})
+	defer DeregisterGroup(g.Name())
+	serverURL := serveTLS(t, server)
+	server.self = serverURL
+	server.Set(serverURL, "https://127.0.0.1:1")
+
+	get := func(opts HTTPPoolOptions) error {
+		opts.BasePath = defaultBasePath
+		client := &HTTPPool{self: "https://127.0.0.1:1", opts: opts}
+		client.Set(serverURL)
+		out := new(pb.GetResponse)
+		err := client.httpGetters[serverURL].Get(nil, &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}, out)
+		if err == nil && string(out.Value) != "secret:k" {
+			t.Errorf("value = %q; want %q", out.Value, "secret:k")
+		}
+		return err
+	}
+
+	if err := get(HTTPPoolOptions{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSCAFile: caFile}); err != nil {
+		t.Errorf("Get from a peer: %v", err)
+	}
+	if err := get(HTTPPoolOptions{TLSCAFile: caFile}); err == nil {
+		t.Error("Get without a client certificate succeeded")
+	}
+	strangerCert, strangerKey, _ := ca.issue(t, dir, "stranger.example")
+	if err := get(HTTPPoolOptions{TLSCertFile: strangerCert, TLSKeyFile: strangerKey, TLSCAFile: caFile}); err == nil {
+		t.Error("Get with the certificate of a host not in the peer list succeeded")
+	}
+	otherDir := t.TempDir()
+	otherCA := newTestCA(t)
+	otherCert, otherKey, _ := otherCA.issue(t, otherDir, "127.0.0.1")
+	if err := get(HTTPPoolOptions{TLSCertFile: otherCert, TLSKeyFile: otherKey, TLSCAFile: caFile}); err == nil {
+		t.Error("Get with a certificate from another CA succeeded")
+	}
+	if err := get(HTTPPoolOptions{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSCAFile: otherCA.writeCA(t, otherDir)}); err == nil {
+		t.Error("Get from a server with a certificate from another CA succeeded")
+	}
+}
+
+func TestTLSCertReload(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	defer setTimeNow(&now)()
+
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile, serial := ca.issue(t, dir, "127.0.0.1")
+	tl := &peerTLS{certFile: certFile, keyFile: keyFile}
+	served := func() int64 {
+		cert, _, err := tl.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if got := served(); got != serial {
+		t.Fatalf("serial = %d; want %d", got, serial)
+	}
+
+	_, _, renewed := ca.issue(t, dir, "127.0.0.1")
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{certFile, keyFile} {
+		if err := os.Chtimes(name, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := served(); got != serial {
+		t.Errorf("serial = %d right after renewal; want the old %d until rechecked", got, serial)
+	}
+	now = now.Add(tlsRecheckInterval)
+	if got := served(); got != renewed {
+		t.Errorf("serial = %d after renewal; want %d", got, renewed)
+	}
+
+	// A broken renewal keeps the last good certificate.
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(tlsRecheckInterval)
+	if got := served(); got != renewed {
+		t.Errorf("serial = %d after broken renewal; want %d", got, renewed)
+	}
+}
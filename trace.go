@@ -0,0 +1,144 @@
+// trace.go reports the steps of a Get to a Tracer, so that where the
+// time of a cache miss goes can be seen, for instance as OpenTelemetry
+// spans, and carries trace context in the requests between peers.
+
+package groupcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// A TraceEvent is a step of a Get.
+type TraceEvent int
+
+const (
+	// TraceGetStart is a Get beginning. It is passed to Tracer.Start.
+	TraceGetStart TraceEvent = iota + 1
+	// TraceCacheHit is the key being found in a cache, holding a
+	// value or, with Err set, a negatively cached error.
+	TraceCacheHit
+	// TraceCacheMiss is the key not being found in a cache.
+	TraceCacheMiss
+	// TraceSingleflightJoin is the Get having waited, for Duration,
+	// on a load of the key that another Get started.
+	TraceSingleflightJoin
+	// TracePeerFetch is a fetch of the key from Peer having ended.
+	TracePeerFetch
+	// TraceLocalLoad is a load of the key by the Getter having ended.
+	TraceLocalLoad
+	// TraceSinkPopulated is the value having been set into the
+	// Get's Sink.
+	TraceSinkPopulated
+	// TraceGetEnd is the Get having ended, after Duration.
+	TraceGetEnd
+)
+
+func (e TraceEvent) String() string {
+	switch e {
+	case TraceGetStart:
+		return "get_start"
+	case TraceCacheHit:
+		return "cache_hit"
+	case TraceCacheMiss:
+		return "cache_miss"
+	case TraceSingleflightJoin:
+		return "singleflight_join"
+	case TracePeerFetch:
+		return "peer_fetch"
+	case TraceLocalLoad:
+		return "local_load"
+	case TraceSinkPopulated:
+		return "sink_populated"
+	case TraceGetEnd:
+		return "get_end"
+	}
+	return "unknown"
+}
+
+// A TraceInfo describes a TraceEvent. Fields that do not apply to the
+// event are zero.
+type TraceInfo struct {
+	Event    TraceEvent
+	Group    string
+	Key      string
+	Peer     string        // the peer fetched from
+	Bytes    int           // the size of the value
+	Duration time.Duration // how long the step took
+	Err      error         // what the step failed with
+}
+
+// A Tracer observes the Gets of a group, set with GroupOptions.Tracer.
+// Its methods are called synchronously, and must be safe for
+// concurrent use.
+//
+// A Tracer for OpenTelemetry might start a span in Start, add an event
+// or child span for each step (those ending steps that carry a
+// Duration began that long before Event is called), and end the span
+// at TraceGetEnd.
+type Tracer interface {
+	// Start is called as a Get begins, and returns the Context the
+	// Get proceeds with, which may carry the Get's span. It is what
+	// Event is then called with, and what peers and the Getter get.
+	Start(ctx Context, info TraceInfo) Context
+
+	// Event is called at each later step of the Get.
+	Event(ctx Context, info TraceInfo)
+}
+
+// A TracePropagator carries trace context from one peer to another in
+// the headers of their HTTP requests, set with
+// HTTPPoolOptions.TracePropagator. One for OpenTelemetry wraps a
+// propagation.TextMapPropagator with a propagation.HeaderCarrier.
+type TracePropagator interface {
+	// Inject adds the trace context of ctx, the Context of a Get
+	// fetching from a peer, to the headers of the request to it.
+	Inject(ctx Context, h http.Header)
+
+	// Extract returns ctx, the Context a peer serves a request
+	// with, carrying the trace context found in its headers.
+	Extract(ctx Context, h http.Header) Context
+}
+
+// traceStart reports the start of a Get of key to the group's Tracer,
+// if any, and returns the Context the Get proceeds with and a func to
+// report its end.
+func (g *Group) traceStart(ctx Context, key string) (Context, func(err error)) {
+	t := g.opts.Tracer
+	if t == nil {
+		return ctx, func(error) {}
+	}
+	start := time.Now()
+	ctx = t.Start(ctx, TraceInfo{Event: TraceGetStart, Group: g.name, Key: key})
+	return ctx, func(err error) {
+		t.Event(ctx, TraceInfo{Event: TraceGetEnd, Group: g.name, Key: key, Duration: time.Since(start), Err: err})
+	}
+}
+
+// trace reports info, a step of a Get, to the group's Tracer, if any.
+func (g *Group) trace(ctx Context, info TraceInfo) {
+	if t := g.opts.Tracer; t != nil {
+		info.Group = g.name
+		t.Event(ctx, info)
+	}
+}
+
+// injectTrace adds the trace context of ctx to req, a request to the
+// getter's peer.
+func (h *httpGetter) injectTrace(ctx Context, req *http.Request) {
+	if h.pool != nil && h.pool.opts.TracePropagator != nil {
+		h.pool.opts.TracePropagator.Inject(ctx, req.Header)
+	}
+}
+
+// extractTrace returns ctx, the Context r is served with, carrying the
+// trace context of r. A nil ctx is replaced with r's own.
+func (p *HTTPPool) extractTrace(ctx Context, r *http.Request) Context {
+	if p.opts.TracePropagator == nil {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = r.Context()
+	}
+	return p.opts.TracePropagator.Extract(ctx, r.Header)
+}
@@ -0,0 +1,214 @@
+package groupcache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordingTracer records the events of Gets.
+type recordingTracer struct {
+	mu     sync.Mutex
+	events []TraceInfo
+	seen   chan TraceInfo // if non-nil, gets each event
+}
+
+func (t *recordingTracer) Start(ctx Context, info TraceInfo) Context {
+	t.Event(ctx, info)
+	return "span:" + info.Key
+}
+
+func (t *recordingTracer) Event(ctx Context, info TraceInfo) {
+	t.mu.Lock()
+	t.events = append(t.events, info)
+	t.mu.Unlock()
+	if t.seen != nil {
+		t.seen <- info
+	}
+}
+
+// take returns the events recorded since the last call.
+func (t *recordingTracer) take() []TraceInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.events
+	t.events = nil
+	return events
+}
+
+func traceEvents(infos []TraceInfo) []TraceEvent {
+	var events []TraceEvent
+	for _, info := range infos {
+		events = append(events, info.Event)
+	}
+	return events
+}
+
+func TestTracer(t *testing.T) {
+	tr := &recordingTracer{}
+	var getterCtx Context
+	g := NewGroupOpts("TestTracer-group", 1<<20, GetterFunc(func(ctx Context, key string, dest Sink) error {
+		getterCtx = ctx
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: fakePeers(nil), Tracer: tr})
+	defer DeregisterGroup(g.Name())
+
+	var s string
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	miss := tr.take()
+	want := []TraceEvent{TraceGetStart, TraceCacheMiss, TraceLocalLoad, TraceSinkPopulated, TraceGetEnd}
+	if got := traceEvents(miss); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events of a miss = %v; want %v", got, want)
+	}
+	for _, info := range miss {
+		if info.Group != g.Name() || info.Key != "k" {
+			t.Errorf("%v event of %s/%s; want %s/k", info.Event, info.Group, info.Key, g.Name())
+		}
+	}
+	if load := miss[2]; load.Bytes != len("value") || load.Err != nil {
+		t.Errorf("local load event = %+v; want %d bytes and no error", load, len("value"))
+	}
+	if getterCtx != "span:k" {
+		t.Errorf("Getter got Context %v; want the one Start returned", getterCtx)
+	}
+
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	want = []TraceEvent{TraceGetStart, TraceCacheHit, TraceSinkPopulated, TraceGetEnd}
+	if got := traceEvents(tr.take()); !reflect.DeepEqual(got, want) {
+		t.Errorf("events of a hit = %v; want %v", got, want)
+	}
+}
+
+func TestTracerPeerFetch(t *testing.T) {
+	tr := &recordingTracer{}
+	g := NewGroupOpts("TestTracerPeerFetch-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return errors.New("loaded locally")
+	}), &GroupOptions{Peers: fakePeers([]ProtoGetter{&fakePeer{}}), Tracer: tr})
+	defer DeregisterGroup(g.Name())
+
+	var s string
+	if err := g.Get(nil, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	infos := tr.take()
+	want := []TraceEvent{TraceGetStart, TraceCacheMiss, TracePeerFetch, TraceSinkPopulated, TraceGetEnd}
+	if got := traceEvents(infos); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v; want %v", got, want)
+	}
+	if fetch := infos[2]; fetch.Peer == "" || fetch.Bytes != len("got:k") || fetch.Err != nil {
+		t.Errorf("peer fetch event = %+v; want a peer, %d bytes and no error", fetch, len("got:k"))
+	}
+}
+
+func TestTracerSingleflightJoin(t *testing.T) {
+	tr := &recordingTracer{seen: make(chan TraceInfo, 100)}
+	release := make(chan bool)
+	g := NewGroupOpts("TestTracerSingleflightJoin-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		<-release
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: fakePeers(nil), Tracer: tr})
+	defer DeregisterGroup(g.Name())
+
+	errc := make(chan error, 2)
+	get := func() {
+		var s string
+		errc <- g.Get(nil, "k", StringSink(&s))
+	}
+	go get()
+	go get()
+	for misses := 0; misses < 2; {
+		if info := <-tr.seen; info.Event == TraceCacheMiss {
+			misses++
+		}
+	}
+	// Let the second Get reach the load the first one started.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var joins, loads int
+	for _, info := range tr.take() {
+		switch info.Event {
+		case TraceSingleflightJoin:
+			joins++
+			if info.Err != nil || info.Duration <= 0 {
+				t.Errorf("join event = %+v; want a duration and no error", info)
+			}
+		case TraceLocalLoad:
+			loads++
+		}
+	}
+	if joins != 1 || loads != 1 {
+		t.Errorf("%d joins and %d local loads; want 1 of each", joins, loads)
+	}
+}
+
+// headerPropagator carries a Context that is a string in a header.
+type headerPropagator struct{}
+
+func (headerPropagator) Inject(ctx Context, h http.Header) {
+	if s, ok := ctx.(string); ok {
+		h.Set("X-Trace", s)
+	}
+}
+
+func (headerPropagator) Extract(ctx Context, h http.Header) Context {
+	return "extracted:" + h.Get("X-Trace")
+}
+
+func TestTracePropagator(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		traces []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == defaultBasePath+helloPath {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		traces = append(traces, r.Header.Get("X-Trace"))
+		mu.Unlock()
+		b, _ := proto.Marshal(&pb.GetResponse{Value: []byte("remote")})
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	p := &HTTPPool{self: "http://self", opts: HTTPPoolOptions{BasePath: defaultBasePath, TracePropagator: headerPropagator{}}}
+	g := NewGroupOpts("TestTracePropagator-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("local")
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+	p.Set(srv.URL)
+
+	var s string
+	if err := g.Get("trace-1", "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if s != "remote" || len(traces) != 1 || traces[0] != "trace-1" {
+		t.Errorf("got %q, the peer saw traces %q; want %q from a peer seeing %q", s, traces, "remote", "trace-1")
+	}
+	mu.Unlock()
+
+	req := httptest.NewRequest("GET", defaultBasePath+g.Name()+"/k", nil)
+	req.Header.Set("X-Trace", "trace-2")
+	if ctx := p.extractTrace(nil, req); ctx != "extracted:trace-2" {
+		t.Errorf("served with Context %v; want %q", ctx, "extracted:trace-2")
+	}
+}
@@ -0,0 +1,131 @@
+// validate.go checks the requests an HTTPPool serves, and answers
+// those it refuses with a structured error.
+
+package groupcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultMaxKeyBytes  = 4096
+	defaultMaxBodyBytes = 64 << 20
+
+	// maxErrorBody bounds how much of an error response is read.
+	maxErrorBody = 4 << 10
+)
+
+// An errorBody is the JSON body of an error response from a peer.
+type errorBody struct {
+	// Code names the error, such as "key_too_long", for programs.
+	Code string `json:"code"`
+
+	// Message describes the error, for people.
+	Message string `json:"message"`
+}
+
+// httpError replies to a request with the given status and a JSON
+// errorBody.
+func httpError(w http.ResponseWriter, status int, code, message string) {
+	h := w.Header()
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody{Code: code, Message: message})
+}
+
+// statusError returns the error for res, a response from a peer with
+// a status other than 200 OK, including the message of its errorBody
+// if it has one. Statuses saying the peer refused the request or is
+// overloaded give errors matching ErrUnauthorized or ErrOverloaded.
+func statusError(res *http.Response) error {
+	msg := "server returned: " + res.Status
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+		var body errorBody
+		if err := json.NewDecoder(io.LimitReader(res.Body, maxErrorBody)).Decode(&body); err == nil && body.Message != "" {
+			msg += ": " + body.Message
+		}
+	}
+	if code, ok := httpStatusCodes[res.StatusCode]; ok {
+		return &codeError{code: code, msg: msg}
+	}
+	return errors.New(msg)
+}
+
+// allowMethods reports whether r's method is one of methods. If not,
+// it replies with 405 Method Not Allowed.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	httpError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" not allowed")
+	return false
+}
+
+// readBody reads the body of r. It replies with an error and returns
+// false if the body is larger than MaxBodyBytes or cannot be read.
+func (p *HTTPPool) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	max := p.opts.MaxBodyBytes
+	if max <= 0 {
+		max = defaultMaxBodyBytes
+	}
+	tooLarge := func() ([]byte, bool) {
+		httpError(w, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("body may be at most %d bytes", max))
+		return nil, false
+	}
+	if r.Body == nil {
+		return nil, true
+	}
+	if r.ContentLength > max {
+		return tooLarge()
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "bad_body", "reading body: "+err.Error())
+		return nil, false
+	}
+	if int64(len(body)) > max {
+		return tooLarge()
+	}
+	return body, true
+}
+
+func (p *HTTPPool) maxKeyBytes() int {
+	if p.opts.MaxKeyBytes > 0 {
+		return p.opts.MaxKeyBytes
+	}
+	return defaultMaxKeyBytes
+}
+
+// parsePath returns the group and key named by path, the escaped path
+// of a request under basePath, as made by httpGetter.url.
+func parsePath(basePath, path string) (group, key string, err error) {
+	if !strings.HasPrefix(path, basePath) {
+		return "", "", errors.New("path not under " + basePath)
+	}
+	parts := strings.SplitN(path[len(basePath):], "/", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New("path is not of the form " + basePath + "group/key")
+	}
+	if group, err = url.QueryUnescape(parts[0]); err != nil {
+		return "", "", fmt.Errorf("bad group: %v", err)
+	}
+	if group == "" {
+		return "", "", errors.New("empty group")
+	}
+	if key, err = url.QueryUnescape(parts[1]); err != nil {
+		return "", "", fmt.Errorf("bad key: %v", err)
+	}
+	return group, key, nil
+}
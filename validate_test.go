@@ -0,0 +1,124 @@
+package groupcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTPValidation(t *testing.T) {
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{MaxKeyBytes: 32, MaxBodyBytes: 16})
+	g := NewGroupOpts("TestServeHTTPValidation-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+	p.Set("http://self")
+
+	base := defaultBasePath + g.Name() + "/"
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", base + "k", "", http.StatusOK, ""},
+		{"POST", base + "k", "v", http.StatusOK, ""},
+		{"GET", "/elsewhere/" + g.Name() + "/k", "", http.StatusNotFound, "bad_path"},
+		{"GET", defaultBasePath + g.Name(), "", http.StatusBadRequest, "bad_path"},
+		{"GET", defaultBasePath + "/k", "", http.StatusBadRequest, "bad_path"},
+		{"GET", defaultBasePath + "noSuchGroup/k", "", http.StatusNotFound, "no_such_group"},
+		{"GET", base + strings.Repeat("k", 33), "", http.StatusRequestURITooLong, "key_too_long"},
+		{"GET", base + "k", "v", http.StatusBadRequest, "unexpected_body"},
+		{"POST", base + "k", "", http.StatusBadRequest, "missing_value"},
+		{"POST", base + "k", strings.Repeat("v", 17), http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"DELETE", base + "k", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"POST", defaultBasePath + healthPath, "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"PUT", base + "k", "not a proto", http.StatusBadRequest, "bad_handoff"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status = %d; want %d", tt.method, tt.path, rec.Code, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		var body errorBody
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != tt.code || body.Message == "" {
+			t.Errorf("%s %s: body = %q; want a JSON error with code %q", tt.method, tt.path, rec.Body, tt.code)
+		}
+		if tt.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") == "" {
+			t.Errorf("%s %s: no Allow header", tt.method, tt.path)
+		}
+	}
+}
+
+func FuzzParsePath(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"group", "key"},
+		{"a/b", "c/d"},
+		{"spaces in", "+plus+ %percent%"},
+		{"g", ""},
+		{"ünïcödé", "\x00\xff"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, group, key string) {
+		if group == "" {
+			return
+		}
+		h := &httpGetter{baseURL: "http://peer" + defaultBasePath}
+		u, err := url.Parse(h.url(group, key))
+		if err != nil {
+			t.Fatalf("url(%q, %q) does not parse: %v", group, key, err)
+		}
+		g, k, err := parsePath(defaultBasePath, u.EscapedPath())
+		if err != nil || g != group || k != key {
+			t.Errorf("parsePath(%q) = %q, %q, %v; want %q, %q", u.EscapedPath(), g, k, err, group, key)
+		}
+	})
+}
+
+func FuzzServeHTTPPath(f *testing.F) {
+	p := NewHTTPPoolOpts("http://self", nil)
+	g := NewGroupOpts("FuzzServeHTTPPath-group", 1<<20, GetterFunc(func(_ Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), &GroupOptions{Peers: p})
+	defer DeregisterGroup(g.Name())
+	p.Set("http://self")
+
+	for _, seed := range []string{
+		defaultBasePath + g.Name() + "/k",
+		defaultBasePath,
+		defaultBasePath + "%",
+		defaultBasePath + g.Name() + "/%2F%2f/",
+		"/",
+		"//x",
+		defaultBasePath + healthPath,
+		defaultBasePath + breakersPath,
+	} {
+		f.Add("GET", seed)
+	}
+	f.Add("PUT", defaultBasePath+g.Name()+"/k")
+	f.Fuzz(func(t *testing.T, method, path string) {
+		u, err := url.Parse(path)
+		if err != nil || !validMethod(method) {
+			return
+		}
+		r := &http.Request{Method: method, URL: u, Header: make(http.Header), Body: http.NoBody}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, r)
+		if rec.Code >= 500 {
+			t.Errorf("%s %q: status = %d", method, path, rec.Code)
+		}
+	})
+}
+
+// validMethod reports whether m could be the method of a request.
+func validMethod(m string) bool {
+	return m != "" && !strings.ContainsAny(m, " \t\r\n/")
+}